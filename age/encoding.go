@@ -0,0 +1,25 @@
+package age
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age/armor"
+)
+
+// ciphertextReader reads armored ciphertext as is, anything else is taken as base64 of
+// the binary age format.
+func ciphertextReader(s string) (io.Reader, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, armor.Header) {
+		return armor.NewReader(strings.NewReader(s)), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("ciphertext is neither armored nor base64 encoded")
+	}
+	return bytes.NewReader(b), nil
+}
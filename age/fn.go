@@ -3,54 +3,109 @@ package age
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"fmt"
 	"io"
-	"strings"
 
 	"filippo.io/age"
 	"filippo.io/age/armor"
+	"github.com/jcouyang/pulumi-keygen/internal/encoding"
 	"github.com/pulumi/pulumi-go-provider/infer"
 )
 
 type Encrypt struct{}
 
 func (Encrypt) Invoke(_ context.Context, req infer.FunctionRequest[EncryptArgs]) (resp infer.FunctionResponse[EncryptResult], err error) {
+	switch {
+	case len(req.Input.Recipients) > 0 && len(req.Input.Passphrase) > 0:
+		return resp, fmt.Errorf("only one of recipients and passphrase can be provided")
+	case len(req.Input.Recipients) == 0 && len(req.Input.Passphrase) == 0:
+		return resp, fmt.Errorf("one of recipients and passphrase must be provided")
+	case !validWorkFactor(req.Input.WorkFactor):
+		return resp, fmt.Errorf("workFactor must be between 1 and 30, or 0 for the default, got %d", req.Input.WorkFactor)
+	}
+
 	var recipients []age.Recipient
+	if len(req.Input.Passphrase) > 0 {
+		r, err := newScryptRecipient(req.Input.Passphrase, req.Input.WorkFactor)
+		if err != nil {
+			return resp, err
+		}
+		recipients = append(recipients, r)
+	}
 	for _, r := range req.Input.Recipients {
-		parsed, err := age.ParseRecipients(strings.NewReader(r))
+		parsed, err := parseRecipients(r)
 		if err != nil {
 			return resp, err
 		}
 		recipients = append(recipients, parsed...)
 	}
 
-	out := &bytes.Buffer{}
-	armorWriter := armor.NewWriter(out)
-	defer armorWriter.Close()
-	w, err := age.Encrypt(armorWriter, recipients...)
-	defer w.Close()
+	plaintext, err := encoding.Decode(req.Input.PlaintextEncoding, req.Input.Plaintext)
 	if err != nil {
-		return resp, err
+		return resp, fmt.Errorf("failed to decode plaintext: %s", err)
 	}
-	if _, err := io.WriteString(w, req.Input.Plaintext); err != nil {
+	armored := req.Input.Armor == nil || *req.Input.Armor
+
+	out := &bytes.Buffer{}
+	if err := encrypt(out, plaintext, armored, recipients...); err != nil {
 		return resp, err
 	}
+	result := out.String()
+	if !armored {
+		result = base64.StdEncoding.EncodeToString(out.Bytes())
+	}
 	return infer.FunctionResponse[EncryptResult]{
-		Output: EncryptResult{Result: out.String()},
+		Output: EncryptResult{Result: result},
 	}, nil
 }
 
+// encrypt writes the complete age file to dst, the age stream and armor must both be
+// closed before the output can be read.
+func encrypt(dst io.Writer, plaintext []byte, armored bool, recipients ...age.Recipient) error {
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(dst)
+		dst = armorWriter
+	}
+	w, err := age.Encrypt(dst, recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if armorWriter != nil {
+		return armorWriter.Close()
+	}
+	return nil
+}
+
 func (r *Encrypt) Annotate(a infer.Annotator) {
 	a.Describe(r, "Encrypt encrypts a file to one or more recipients.")
 }
 
 type EncryptArgs struct {
-	Recipients []string `pulumi:"recipients"`
+	Recipients []string `pulumi:"recipients,optional"`
+	Passphrase string   `pulumi:"passphrase,optional" provider:"secret"`
+	WorkFactor int      `pulumi:"workFactor,optional"`
 	Plaintext  string   `pulumi:"plaintext" provider:"secret"`
+
+	PlaintextEncoding string `pulumi:"plaintextEncoding,optional"`
+	Armor             *bool  `pulumi:"armor,optional"`
 }
 
 func (er *EncryptArgs) Annotate(a infer.Annotator) {
 	a.Describe(&er.Plaintext, "The plaintext to encrypt.")
-	a.Describe(&er.Recipients, "The recipients to encrypt to.")
+	a.Describe(&er.PlaintextEncoding, "How plaintext is encoded, use base64 or hex for binary data. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&er.Armor, "Whether to PEM armor the result. When false the result is base64 of the binary age format. Default is true.")
+	a.SetDefault(&er.Armor, true)
+	a.Describe(&er.Recipients, "The recipients to encrypt to, age1... or post-quantum age1pq1... recipients, or ssh-ed25519/ssh-rsa public keys. Conflicts with passphrase.")
+	a.Describe(&er.Passphrase, "The passphrase to encrypt to with scrypt. Conflicts with recipients.")
+	a.Describe(&er.WorkFactor, "The scrypt work factor as log2(N), between 1 and 30, only used with passphrase. Default is 18.")
 }
 
 type EncryptResult struct {
@@ -65,12 +120,40 @@ func (d *Decrypt) Annotate(a infer.Annotator) {
 
 func (Decrypt) Invoke(_ context.Context, req infer.FunctionRequest[DecryptArgs]) (resp infer.FunctionResponse[DecryptResult], err error) {
 	out := &bytes.Buffer{}
-	armorReader := armor.NewReader(strings.NewReader(req.Input.Ciphertext))
-	identity, err := age.ParseX25519Identity(req.Input.Identity)
+	src, err := ciphertextReader(req.Input.Ciphertext)
 	if err != nil {
 		return resp, err
 	}
-	r, err := age.Decrypt(armorReader, identity)
+	hasIdentity := len(req.Input.Identity) > 0 || len(req.Input.Identities) > 0
+	switch {
+	case hasIdentity && len(req.Input.Passphrase) > 0:
+		return resp, fmt.Errorf("only one of identity, identities and passphrase can be provided")
+	case !hasIdentity && len(req.Input.Passphrase) == 0:
+		return resp, fmt.Errorf("one of identity, identities and passphrase must be provided")
+	case !validWorkFactor(req.Input.MaxWorkFactor):
+		return resp, fmt.Errorf("maxWorkFactor must be between 1 and 30, or 0 for the default, got %d", req.Input.MaxWorkFactor)
+	}
+
+	m := &match{}
+	var identities []age.Identity
+	if len(req.Input.Passphrase) > 0 {
+		identity, err := newScryptIdentity(req.Input.Passphrase, req.Input.MaxWorkFactor)
+		if err != nil {
+			return resp, err
+		}
+		identities = append(identities, matchingIdentity{identity, "", m})
+	}
+	for _, i := range append([]string{req.Input.Identity}, req.Input.Identities...) {
+		if len(i) == 0 {
+			continue
+		}
+		parsed, err := parseIdentities(i, req.Input.IdentityPassphrase, m)
+		if err != nil {
+			return resp, err
+		}
+		identities = append(identities, parsed...)
+	}
+	r, err := age.Decrypt(src, identities...)
 	if err != nil {
 		return resp, err
 	}
@@ -78,21 +161,50 @@ func (Decrypt) Invoke(_ context.Context, req infer.FunctionRequest[DecryptArgs])
 		return resp, err
 	}
 
+	result, err := encoding.Encode(req.Input.ResultEncoding, out.Bytes())
+	if err != nil {
+		return resp, err
+	}
+
 	return infer.FunctionResponse[DecryptResult]{
-		Output: DecryptResult{Result: out.String()},
+		Output: DecryptResult{
+			Result:           result,
+			MatchedRecipient: m.recipient,
+			MatchedStanza:    m.stanza,
+			MatchedIndex:     m.index,
+		},
 	}, nil
 }
 
 type DecryptArgs struct {
-	Identity   string `pulumi:"identity" provider:"secret"`
-	Ciphertext string `pulumi:"ciphertext"`
+	Identity           string   `pulumi:"identity,optional" provider:"secret"`
+	Identities         []string `pulumi:"identities,optional" provider:"secret"`
+	IdentityPassphrase string   `pulumi:"identityPassphrase,optional" provider:"secret"`
+	Passphrase         string   `pulumi:"passphrase,optional" provider:"secret"`
+	MaxWorkFactor      int      `pulumi:"maxWorkFactor,optional"`
+	Ciphertext         string   `pulumi:"ciphertext"`
+	ResultEncoding     string   `pulumi:"resultEncoding,optional"`
 }
 
 func (r *DecryptArgs) Annotate(a infer.Annotator) {
-	a.Describe(&r.Identity, "The identity to decrypt with.")
-	a.Describe(&r.Ciphertext, "The ciphertext to decrypt.")
+	a.Describe(&r.Identity, "The identity to decrypt with, AGE-SECRET-KEY-1... or post-quantum AGE-SECRET-KEY-PQ-1... identity, an identity file, or an ed25519/RSA OpenSSH private key.")
+	a.Describe(&r.Identities, "More identities to try, each in any of the forms accepted by identity. Identity files may hold several identities, one per line, and # comments.")
+	a.Describe(&r.IdentityPassphrase, "The passphrase of a passphrase protected OpenSSH private key identity.")
+	a.Describe(&r.Passphrase, "The passphrase the ciphertext was encrypted to. Conflicts with identity.")
+	a.Describe(&r.MaxWorkFactor, "The maximum scrypt work factor as log2(N) accepted when decrypting with passphrase. Default is 22.")
+	a.Describe(&r.Ciphertext, "The ciphertext to decrypt, either armored or base64 of the binary age format.")
+	a.Describe(&r.ResultEncoding, "How the decrypted result is encoded, use base64 or hex for binary data. utf8 | base64 | hex. Default is utf8.")
 }
 
 type DecryptResult struct {
-	Result string `pulumi:"result"`
+	Result           string `pulumi:"result" provider:"secret"`
+	MatchedRecipient string `pulumi:"matchedRecipient"`
+	MatchedStanza    string `pulumi:"matchedStanza"`
+	MatchedIndex     int    `pulumi:"matchedIndex"`
+}
+
+func (r *DecryptResult) Annotate(a infer.Annotator) {
+	a.Describe(&r.MatchedRecipient, "The recipient of the identity that decrypted the ciphertext, empty for passphrase.")
+	a.Describe(&r.MatchedStanza, "The type of the recipient stanza that matched, e.g. X25519, mlkem768x25519, ssh-ed25519 or scrypt.")
+	a.Describe(&r.MatchedIndex, "The position of the matched recipient stanza in the ciphertext header.")
 }
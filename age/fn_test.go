@@ -0,0 +1,321 @@
+package age
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jcouyang/pulumi-keygen/internal/encoding"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKey returns the authorized key and the OpenSSH private key of key, protected with
+// passphrase unless it is empty.
+func sshKey(t *testing.T, key crypto.Signer, passphrase string) (string, string) {
+	t.Helper()
+	public, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "keygen", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, "keygen")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(public))), string(pem.EncodeToMemory(block))
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	alice, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := make([]byte, 4096)
+	if _, err := rand.Read(binary); err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave, daveIdentity := sshKey(t, ed25519Key, "")
+	_, daveProtected := sshKey(t, ed25519Key, "open sesame")
+	erin, erinIdentity := sshKey(t, rsaKey, "")
+	unarmored := false
+
+	tests := []struct {
+		name    string
+		args    EncryptArgs
+		decrypt []DecryptArgs
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			args:    EncryptArgs{Recipients: []string{alice.Recipient().String()}, Plaintext: ""},
+			decrypt: []DecryptArgs{{Identity: alice.String()}},
+		},
+		{
+			name:    "small",
+			args:    EncryptArgs{Recipients: []string{alice.Recipient().String()}, Plaintext: "hello"},
+			decrypt: []DecryptArgs{{Identity: alice.String()}},
+		},
+		{
+			name:    "large",
+			args:    EncryptArgs{Recipients: []string{alice.Recipient().String()}, Plaintext: strings.Repeat("keygen", 1<<18)},
+			decrypt: []DecryptArgs{{Identity: alice.String()}},
+		},
+		{
+			name: "multi-recipient",
+			args: EncryptArgs{
+				Recipients: []string{alice.Recipient().String(), bob.Recipient().String()},
+				Plaintext:  "hello",
+			},
+			decrypt: []DecryptArgs{{Identity: alice.String()}, {Identity: bob.String()}},
+		},
+		{
+			name:    "post-quantum",
+			args:    EncryptArgs{Recipients: []string{carol.Recipient().String()}, Plaintext: "hello"},
+			decrypt: []DecryptArgs{{Identity: carol.String()}},
+		},
+		{
+			name:    "passphrase",
+			args:    EncryptArgs{Passphrase: "correct horse battery staple", WorkFactor: 10, Plaintext: "hello"},
+			decrypt: []DecryptArgs{{Passphrase: "correct horse battery staple"}},
+		},
+		{
+			name: "binary unarmored",
+			args: EncryptArgs{
+				Recipients:        []string{alice.Recipient().String()},
+				Plaintext:         base64.StdEncoding.EncodeToString(binary),
+				PlaintextEncoding: encoding.Base64,
+				Armor:             &unarmored,
+			},
+			decrypt: []DecryptArgs{{Identity: alice.String(), ResultEncoding: encoding.Base64}},
+		},
+		{
+			name:    "ssh-ed25519",
+			args:    EncryptArgs{Recipients: []string{dave}, Plaintext: "hello"},
+			decrypt: []DecryptArgs{{Identity: daveIdentity}, {Identity: daveProtected, IdentityPassphrase: "open sesame"}},
+		},
+		{
+			name:    "ssh-rsa",
+			args:    EncryptArgs{Recipients: []string{erin}, Plaintext: "hello"},
+			decrypt: []DecryptArgs{{Identity: erinIdentity}},
+		},
+		{
+			name:    "invalid recipient",
+			args:    EncryptArgs{Recipients: []string{"age1invalid"}, Plaintext: "hello"},
+			wantErr: true,
+		},
+		{
+			name:    "mixed post-quantum and classic recipients",
+			args:    EncryptArgs{Recipients: []string{alice.Recipient().String(), carol.Recipient().String()}, Plaintext: "hello"},
+			wantErr: true,
+		},
+		{
+			name:    "work factor out of range",
+			args:    EncryptArgs{Passphrase: "secret", WorkFactor: 31, Plaintext: "hello"},
+			wantErr: true,
+		},
+		{
+			name:    "recipients and passphrase",
+			args:    EncryptArgs{Recipients: []string{alice.Recipient().String()}, Passphrase: "secret", Plaintext: "hello"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt{}.Invoke(context.Background(), infer.FunctionRequest[EncryptArgs]{Input: tt.args})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected encrypt to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("encrypt: %s", err)
+			}
+			for _, args := range tt.decrypt {
+				args.Ciphertext = enc.Output.Result
+				dec, err := Decrypt{}.Invoke(context.Background(), infer.FunctionRequest[DecryptArgs]{Input: args})
+				if err != nil {
+					t.Fatalf("decrypt: %s", err)
+				}
+				if dec.Output.Result != tt.args.Plaintext {
+					t.Fatalf("decrypted %d bytes, expected %d bytes", len(dec.Output.Result), len(tt.args.Plaintext))
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptWrongIdentity(t *testing.T) {
+	alice, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := Encrypt{}.Invoke(context.Background(), infer.FunctionRequest[EncryptArgs]{
+		Input: EncryptArgs{Recipients: []string{alice.Recipient().String()}, Plaintext: "hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Decrypt{}.Invoke(context.Background(), infer.FunctionRequest[DecryptArgs]{
+		Input: DecryptArgs{Identity: mallory.String(), Ciphertext: enc.Output.Result},
+	})
+	if err == nil {
+		t.Fatal("expected decrypt with a wrong identity to fail")
+	}
+}
+
+func TestDecryptSSHWrongPassphrase(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, identity := sshKey(t, key, "open sesame")
+	enc, err := Encrypt{}.Invoke(context.Background(), infer.FunctionRequest[EncryptArgs]{
+		Input: EncryptArgs{Recipients: []string{recipient}, Plaintext: "hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, passphrase := range []string{"", "wrong"} {
+		_, err = Decrypt{}.Invoke(context.Background(), infer.FunctionRequest[DecryptArgs]{
+			Input: DecryptArgs{Identity: identity, IdentityPassphrase: passphrase, Ciphertext: enc.Output.Result},
+		})
+		if err == nil {
+			t.Fatalf("expected decrypt with identityPassphrase %q to fail", passphrase)
+		}
+	}
+}
+
+func TestDecryptMatch(t *testing.T) {
+	alice, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dave, daveIdentity := sshKey(t, key, "")
+	encrypt := func(args EncryptArgs) string {
+		t.Helper()
+		enc, err := Encrypt{}.Invoke(context.Background(), infer.FunctionRequest[EncryptArgs]{Input: args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc.Output.Result
+	}
+	toAll := encrypt(EncryptArgs{Recipients: []string{alice.Recipient().String(), bob.Recipient().String(), dave}, Plaintext: "hello"})
+	identityFile := strings.Join([]string{
+		"# created: 2024-01-01T00:00:00Z",
+		"# public key: " + mallory.Recipient().String(),
+		mallory.String(),
+		"",
+		"# public key: " + bob.Recipient().String(),
+		bob.String(),
+	}, "\n")
+
+	tests := []struct {
+		name      string
+		args      DecryptArgs
+		recipient string
+		stanza    string
+		index     int
+	}{
+		{
+			name:      "identity",
+			args:      DecryptArgs{Identity: alice.String(), Ciphertext: toAll},
+			recipient: alice.Recipient().String(),
+			stanza:    "X25519",
+			index:     0,
+		},
+		{
+			name:      "identities",
+			args:      DecryptArgs{Identities: []string{mallory.String(), bob.String()}, Ciphertext: toAll},
+			recipient: bob.Recipient().String(),
+			stanza:    "X25519",
+			index:     1,
+		},
+		{
+			name:      "identity file",
+			args:      DecryptArgs{Identity: identityFile, Ciphertext: toAll},
+			recipient: bob.Recipient().String(),
+			stanza:    "X25519",
+			index:     1,
+		},
+		{
+			name:      "ssh identity",
+			args:      DecryptArgs{Identities: []string{mallory.String(), daveIdentity}, Ciphertext: toAll},
+			recipient: dave,
+			stanza:    "ssh-ed25519",
+			index:     2,
+		},
+		{
+			name:   "passphrase",
+			args:   DecryptArgs{Passphrase: "secret", Ciphertext: encrypt(EncryptArgs{Passphrase: "secret", WorkFactor: 10, Plaintext: "hello"})},
+			stanza: "scrypt",
+			index:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec, err := Decrypt{}.Invoke(context.Background(), infer.FunctionRequest[DecryptArgs]{Input: tt.args})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dec.Output.Result != "hello" {
+				t.Fatalf("unexpected result %q", dec.Output.Result)
+			}
+			if dec.Output.MatchedRecipient != tt.recipient || dec.Output.MatchedStanza != tt.stanza || dec.Output.MatchedIndex != tt.index {
+				t.Fatalf("matched %s %s at %d, expected %s %s at %d", dec.Output.MatchedRecipient, dec.Output.MatchedStanza, dec.Output.MatchedIndex, tt.recipient, tt.stanza, tt.index)
+			}
+		})
+	}
+
+	_, err = Decrypt{}.Invoke(context.Background(), infer.FunctionRequest[DecryptArgs]{
+		Input: DecryptArgs{Identity: "# only a comment\n", Ciphertext: toAll},
+	})
+	if err == nil {
+		t.Fatal("expected an identity file without identities to fail")
+	}
+}
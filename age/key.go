@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"time"
+	"reflect"
+	"strings"
 
 	"filippo.io/age"
+	"github.com/jcouyang/pulumi-keygen/derive"
 	"github.com/jcouyang/pulumi-keygen/internal/bech32"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
 	"golang.org/x/crypto/curve25519"
@@ -20,64 +24,138 @@ func (f *Identity) Annotate(a infer.Annotator) {
 }
 
 type IdentityArgs struct {
-	ValidityPeriodHours int    `pulumi:"validityPeriodHours,optional"`
-	EarlyRenewalHours   int    `pulumi:"earlyRenewalHours,optional"`
-	Random              string `pulumi:"random,optional" provider:"secret"`
+	rotation.Args
+	Random      string `pulumi:"random,optional" provider:"secret"`
+	ExistingKey string `pulumi:"privateKey,optional" provider:"secret"`
+	KeyType     string `pulumi:"keyType,optional"`
+	Retain      int    `pulumi:"retainPreviousVersions,optional"`
+
+	Derivation *derive.Derivation `pulumi:"derivation,optional"`
 }
 
 func (f *IdentityArgs) Annotate(a infer.Annotator) {
-	a.Describe(&f.ValidityPeriodHours, "Number of hours, after initial issuing, that the key will remain valid for.")
-	a.Describe(&f.EarlyRenewalHours, "Number of hours, before expiration, that the key will be renewed.")
 	a.Describe(&f.Random, "Custom random bytes, it must be 32 bytes, base64 encoded, optional, if not provided go rand is used to generate the random bytes")
+	a.Describe(&f.ExistingKey, "An existing AGE-SECRET-KEY-1... or AGE-SECRET-KEY-PQ-1... identity to adopt instead of generating a new one, conflicts with random")
+	a.Describe(&f.KeyType, "The type of identity to generate. X25519 | MLKEM768X25519. MLKEM768X25519 is the post-quantum hybrid identity with age1pq1... recipients. Default is X25519.")
+	a.Describe(&f.Derivation, "Derive the identity with HKDF from a master secret and a label instead of generating it, the same master and label always derive the same identity. Conflicts with random and privateKey")
+	a.Describe(&f.Retain, "Number of previous identities to keep in previousVersions, when set the identity is rotated in place instead of replaced. Default is 0.")
 }
 
 type IdentityState struct {
 	IdentityArgs
+	PrivateKey string `pulumi:"key" provider:"secret"`
+	Recipient  string `pulumi:"recipient"`
+	rotation.State
+	PreviousVersions []PreviousIdentity `pulumi:"previousVersions,optional" provider:"secret"`
+}
+
+func (f *IdentityState) Annotate(a infer.Annotator) {
+	a.Describe(&f.PreviousVersions, "Identities replaced by rotation, newest first, to decrypt data still encrypted to them.")
+}
+
+type PreviousIdentity struct {
 	PrivateKey string `pulumi:"key" provider:"secret"`
 	Recipient  string `pulumi:"recipient"`
 	Created    int64  `pulumi:"created"`
 }
 
-func (Identity) Create(ctx context.Context, req infer.CreateRequest[IdentityArgs]) (resp infer.CreateResponse[IdentityState], err error) {
-	if req.DryRun {
-		return
+func (Identity) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[IdentityArgs], error) {
+	args, failures, err := infer.DefaultCheck[IdentityArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[IdentityArgs]{}, err
 	}
-	var identity *age.X25519Identity
-
-	if len(req.Inputs.Random) > 0 {
-		decoded, err := base64.StdEncoding.DecodeString(req.Inputs.Random)
-		if err != nil {
-			return resp, fmt.Errorf("provided random is not base64 encoded")
-		}
-		if size := len(decoded); size > 0 && size != curve25519.ScalarSize {
-			return resp, fmt.Errorf("provided random has incorrect(%d) size", size)
+	failures = append(failures, rotation.Validate(args.Args, rotation.Now(ctx))...)
+	if args.Retain < 0 {
+		failures = append(failures, p.CheckFailure{Property: "retainPreviousVersions", Reason: "must not be negative"})
+	}
+	if check.Known(req.NewInputs, "keyType") && len(args.KeyType) > 0 {
+		failures = append(failures, check.Enum("keyType", args.KeyType, []string{KeyTypeX25519, KeyTypeMLKEM768X25519})...)
+	}
+	if check.Set(req.NewInputs, "random") && check.Set(req.NewInputs, "privateKey") {
+		failures = append(failures, p.CheckFailure{Property: "privateKey", Reason: "conflicts with random, only one of them can be provided"})
+	}
+	if check.Set(req.NewInputs, "derivation") && (check.Set(req.NewInputs, "random") || check.Set(req.NewInputs, "privateKey")) {
+		failures = append(failures, p.CheckFailure{Property: "derivation", Reason: "conflicts with random and privateKey, only one of them can be provided"})
+	}
+	if check.Known(req.NewInputs, "derivation") && args.Derivation != nil {
+		failures = append(failures, args.Derivation.Check("derivation.", req.NewInputs.Get("derivation").AsMap())...)
+	}
+	if check.Known(req.NewInputs, "random") && len(args.Random) > 0 {
+		if decoded, err := base64.StdEncoding.DecodeString(args.Random); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "random", Reason: "must be base64 encoded"})
+		} else if size := len(decoded); size != curve25519.ScalarSize {
+			failures = append(failures, p.CheckFailure{Property: "random", Reason: fmt.Sprintf("must be %d bytes, got %d", curve25519.ScalarSize, size)})
 		}
-		encoded, err := bech32.Encode("AGE-SECRET-KEY-", decoded)
-		if err != nil {
-			return resp, fmt.Errorf("failed to encode random to bech32")
+	}
+	if check.Known(req.NewInputs, "privateKey") && len(args.ExistingKey) > 0 {
+		if _, err := parseIdentity(args.ExistingKey); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "privateKey", Reason: "must be an AGE-SECRET-KEY-1... or AGE-SECRET-KEY-PQ-1... identity"})
+		} else if prefix, ok := secretKeyPrefixes[keyTypeOrDefault(args.KeyType)]; ok && !strings.HasPrefix(args.ExistingKey, prefix+"1") {
+			failures = append(failures, p.CheckFailure{Property: "privateKey", Reason: fmt.Sprintf("must be a %s identity", keyTypeOrDefault(args.KeyType))})
 		}
-		identity, err = age.ParseX25519Identity(encoded)
-	} else {
-		identity, err = age.GenerateX25519Identity()
 	}
-	if err != nil {
-		return infer.CreateResponse[IdentityState]{}, fmt.Errorf("failed to generate x25519 identity: %s", err)
+	return infer.CheckResponse[IdentityArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (Identity) Create(ctx context.Context, req infer.CreateRequest[IdentityArgs]) (resp infer.CreateResponse[IdentityState], err error) {
+	if req.DryRun {
+		return
 	}
-	recipient := identity.Recipient().String()
+	identity, err := newIdentity(req.Inputs)
 	if err != nil {
-		return resp, err
+		return
 	}
+	key, recipient := encodeIdentity(identity)
 	return infer.CreateResponse[IdentityState]{
 		ID: recipient,
 		Output: IdentityState{
 			req.Inputs,
-			identity.String(),
+			key,
 			recipient,
-			time.Now().Unix(),
+			rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+			nil,
 		},
 	}, nil
 }
 
+func (Identity) Read(ctx context.Context, req infer.ReadRequest[IdentityArgs, IdentityState]) (resp infer.ReadResponse[IdentityArgs, IdentityState], err error) {
+	inputs, state := req.Inputs, req.State
+	if len(state.PrivateKey) == 0 {
+		// Nothing in state means the identity is being imported, either from the
+		// privateKey input or from an AGE-SECRET-KEY-1... identity given as the ID.
+		if len(inputs.ExistingKey) == 0 {
+			if !strings.HasPrefix(req.ID, "AGE-SECRET-KEY-") {
+				return resp, fmt.Errorf("identity can only be imported by its AGE-SECRET-KEY-1... private key or the privateKey input")
+			}
+			inputs.ExistingKey = req.ID
+		}
+		if len(inputs.KeyType) == 0 && strings.HasPrefix(inputs.ExistingKey, secretKeyPrefixes[KeyTypeMLKEM768X25519]+"1") {
+			// keyType defaults to X25519, which Check would reject for the adopted key
+			inputs.KeyType = KeyTypeMLKEM768X25519
+		}
+		state = IdentityState{
+			IdentityArgs: inputs,
+			PrivateKey:   inputs.ExistingKey,
+			State:        rotation.New(inputs.Args, rotation.Now(ctx)),
+		}
+	}
+	identity, err := parseIdentity(state.PrivateKey)
+	if err != nil {
+		return resp, fmt.Errorf("failed to parse identity: %s", err)
+	}
+	_, recipient := encodeIdentity(identity)
+	if len(state.Recipient) > 0 && recipient != state.Recipient {
+		p.GetLogger(ctx).Warningf("recipient of %s does not match its private key", req.ID)
+	}
+	state.Recipient = recipient
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	return infer.ReadResponse[IdentityArgs, IdentityState]{
+		ID:     state.Recipient,
+		Inputs: inputs,
+		State:  state,
+	}, nil
+}
+
 func (Identity) Delete(ctx context.Context, req infer.DeleteRequest[IdentityState]) (infer.DeleteResponse, error) {
 	return infer.DeleteResponse{}, nil
 }
@@ -86,32 +164,46 @@ func (Identity) Update(ctx context.Context, req infer.UpdateRequest[IdentityArgs
 	if req.DryRun {
 		return infer.UpdateResponse[IdentityState]{}, nil
 	}
-	return infer.UpdateResponse[IdentityState]{
-		Output: IdentityState{
-			req.Inputs,
-			req.State.PrivateKey,
-			req.State.Recipient,
-			req.State.Created,
-		},
-	}, nil
+	state := req.State
+	state.IdentityArgs = req.Inputs
+	state.State = rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx))
+	if req.Inputs.Retain > 0 && rotation.Rotate(req.Inputs.Args, req.State.Args, req.State.Created, rotation.Now(ctx)) {
+		identity, err := newIdentity(req.Inputs)
+		if err != nil {
+			return infer.UpdateResponse[IdentityState]{}, err
+		}
+		if key, recipient := encodeIdentity(identity); key != state.PrivateKey {
+			state.PreviousVersions = append([]PreviousIdentity{{state.PrivateKey, state.Recipient, state.Created}}, state.PreviousVersions...)
+			state.PrivateKey, state.Recipient = key, recipient
+		}
+		// random, privateKey and derivation always give the same identity, the rotation
+		// still restarts so the identity is not reported expired again on the next diff
+		state.State = rotation.New(req.Inputs.Args, rotation.Now(ctx))
+	}
+	state.PreviousVersions = rotation.Retain(state.PreviousVersions, req.Inputs.Retain)
+	return infer.UpdateResponse[IdentityState]{Output: state}, nil
 }
 
 func (Identity) Diff(ctx context.Context, req infer.DiffRequest[IdentityArgs, IdentityState]) (infer.DiffResponse, error) {
 	diff := map[string]p.PropertyDiff{}
-	if req.Inputs.EarlyRenewalHours != req.State.EarlyRenewalHours {
-		diff["earlyRenewalHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-	if req.Inputs.ValidityPeriodHours != req.State.ValidityPeriodHours {
-		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.Update}
-	}
 	if req.Inputs.Random != req.State.Random {
 		diff["random"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
-	if req.Inputs.ValidityPeriodHours != 0 &&
-		time.Now().Unix() >=
-			req.State.Created+int64(req.Inputs.ValidityPeriodHours-req.Inputs.EarlyRenewalHours)*60*60 {
-		diff["expired"] = p.PropertyDiff{Kind: p.UpdateReplace}
-		p.GetLogger(ctx).Warningf("key %s is about to expire, will be replaced if perform this update!", req.ID)
+	if req.Inputs.ExistingKey != req.State.ExistingKey {
+		diff["privateKey"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !reflect.DeepEqual(req.Inputs.Derivation, req.State.Derivation) {
+		diff["derivation"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if keyTypeOrDefault(req.Inputs.KeyType) != keyTypeOrDefault(req.State.KeyType) {
+		diff["keyType"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.Retain != req.State.Retain {
+		diff["retainPreviousVersions"] = p.PropertyDiff{Kind: p.Update}
+	}
+	rotation.Diff(ctx, req.ID, req.Inputs.Args, req.State.Args, req.State.State, diff)
+	if req.Inputs.Retain > 0 {
+		rotation.InPlace(diff)
 	}
 	return infer.DiffResponse{
 		DeleteBeforeReplace: false,
@@ -122,4 +214,119 @@ func (Identity) Diff(ctx context.Context, req infer.DiffRequest[IdentityArgs, Id
 
 func (Identity) WireDependencies(f infer.FieldSelector, args *IdentityArgs, state *IdentityState) {
 	f.OutputField(&state.PrivateKey).DependsOn(f.InputField(&args.Random))
+	f.OutputField(&state.PrivateKey).DependsOn(f.InputField(&args.ExistingKey))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Random))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.ExistingKey))
+	f.OutputField(&state.PrivateKey).DependsOn(f.InputField(&args.Derivation))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Derivation))
+	f.OutputField(&state.PrivateKey).DependsOn(f.InputField(&args.KeyType))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.KeyType))
+	f.OutputField(&state.PrivateKey).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+	f.OutputField(&state.PreviousVersions).DependsOn(f.InputField(&args.Retain))
+	f.OutputField(&state.PrivateKey).AlwaysSecret()
+	f.OutputField(&state.PreviousVersions).AlwaysSecret()
+	f.OutputField(&state.Recipient).NeverSecret()
+}
+
+// newIdentity generates the identity described by inputs, from random bytes, an existing
+// key or go rand.
+func newIdentity(inputs IdentityArgs) (identity age.Identity, err error) {
+	keyType := keyTypeOrDefault(inputs.KeyType)
+	prefix, ok := secretKeyPrefixes[keyType]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyType %s", inputs.KeyType)
+	}
+	if len(inputs.Random) > 0 && len(inputs.ExistingKey) > 0 || inputs.Derivation != nil && (len(inputs.Random) > 0 || len(inputs.ExistingKey) > 0) {
+		return nil, fmt.Errorf("only one of random, privateKey and derivation can be provided")
+	}
+	if len(inputs.ExistingKey) > 0 {
+		identity, err = parseIdentity(inputs.ExistingKey)
+		if err != nil {
+			return nil, fmt.Errorf("provided privateKey is not a valid identity: %s", err)
+		}
+		if !strings.HasPrefix(inputs.ExistingKey, prefix+"1") {
+			return nil, fmt.Errorf("provided privateKey is not a %s identity", keyType)
+		}
+	} else if len(inputs.Random) > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(inputs.Random)
+		if err != nil {
+			return nil, fmt.Errorf("provided random is not base64 encoded")
+		}
+		if size := len(decoded); size > 0 && size != curve25519.ScalarSize {
+			return nil, fmt.Errorf("provided random has incorrect(%d) size", size)
+		}
+		identity, err = seededIdentity(prefix, decoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s identity: %s", keyType, err)
+		}
+	} else if inputs.Derivation != nil {
+		seed, err := inputs.Derivation.Bytes(curve25519.ScalarSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive identity: %s", err)
+		}
+		identity, err = seededIdentity(prefix, seed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive %s identity: %s", keyType, err)
+		}
+	} else {
+		identity, err = generateIdentity(keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s identity: %s", keyType, err)
+	}
+	return identity, nil
+}
+
+// seededIdentity returns the identity with the secret key prefix whose key material is seed.
+func seededIdentity(prefix string, seed []byte) (age.Identity, error) {
+	encoded, err := bech32.Encode(prefix, seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode seed to bech32")
+	}
+	return parseIdentity(encoded)
+}
+
+const (
+	KeyTypeX25519         = "X25519"
+	KeyTypeMLKEM768X25519 = "MLKEM768X25519"
+)
+
+var secretKeyPrefixes = map[string]string{
+	KeyTypeX25519:         "AGE-SECRET-KEY-",
+	KeyTypeMLKEM768X25519: "AGE-SECRET-KEY-PQ-",
+}
+
+func keyTypeOrDefault(keyType string) string {
+	if len(keyType) == 0 {
+		return KeyTypeX25519
+	}
+	return keyType
+}
+
+func generateIdentity(keyType string) (age.Identity, error) {
+	if keyType == KeyTypeMLKEM768X25519 {
+		return age.GenerateHybridIdentity()
+	}
+	return age.GenerateX25519Identity()
+}
+
+// parseIdentity parses a native age identity, either X25519 or post-quantum hybrid.
+func parseIdentity(s string) (age.Identity, error) {
+	if strings.HasPrefix(s, "AGE-SECRET-KEY-PQ-1") {
+		return age.ParseHybridIdentity(s)
+	}
+	return age.ParseX25519Identity(s)
+}
+
+// encodeIdentity returns the bech32 encoded private key and recipient of a native age identity.
+func encodeIdentity(identity age.Identity) (key string, recipient string) {
+	switch i := identity.(type) {
+	case *age.X25519Identity:
+		return i.String(), i.Recipient().String()
+	case *age.HybridIdentity:
+		return i.String(), i.Recipient().String()
+	}
+	return "", ""
 }
@@ -0,0 +1,245 @@
+package age
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/jcouyang/pulumi-keygen/derive"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestIdentityRotateInPlace(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := created
+	ctx := rotation.WithClock(context.Background(), func() time.Time { return now })
+
+	args := IdentityArgs{Args: rotation.Args{ValidityPeriodHours: 24}, Retain: 1}
+	create, err := Identity{}.Create(ctx, infer.CreateRequest[IdentityArgs]{Inputs: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := create.Output
+
+	for i := 1; i <= 2; i++ {
+		now = created.Add(time.Duration(i*24) * time.Hour)
+		diff, err := Identity{}.Diff(ctx, infer.DiffRequest[IdentityArgs, IdentityState]{ID: state.Recipient, Inputs: args, State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.DetailedDiff["expired"].Kind != p.Update {
+			t.Fatalf("expected expired identity to be updated in place, got %v", diff.DetailedDiff)
+		}
+		update, err := Identity{}.Update(ctx, infer.UpdateRequest[IdentityArgs, IdentityState]{Inputs: args, State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if update.Output.PrivateKey == state.PrivateKey {
+			t.Fatal("expected a new identity")
+		}
+		if len(update.Output.PreviousVersions) != 1 || update.Output.PreviousVersions[0].PrivateKey != state.PrivateKey || update.Output.PreviousVersions[0].Created != state.Created {
+			t.Fatalf("expected only the replaced identity to be kept, got %d versions", len(update.Output.PreviousVersions))
+		}
+		state = update.Output
+
+		diff, err = Identity{}.Diff(ctx, infer.DiffRequest[IdentityArgs, IdentityState]{ID: state.Recipient, Inputs: args, State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.HasChanges {
+			t.Fatalf("expected no changes after the rotation, got %v", diff.DetailedDiff)
+		}
+	}
+}
+
+func TestIdentityRotateFixedKey(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := created
+	ctx := rotation.WithClock(context.Background(), func() time.Time { return now })
+
+	random := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	args := IdentityArgs{Args: rotation.Args{ValidityPeriodHours: 24}, Random: random, Retain: 1}
+	create, err := Identity{}.Create(ctx, infer.CreateRequest[IdentityArgs]{Inputs: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := create.Output
+
+	now = created.Add(24 * time.Hour)
+	update, err := Identity{}.Update(ctx, infer.UpdateRequest[IdentityArgs, IdentityState]{Inputs: args, State: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Output.PrivateKey != state.PrivateKey || len(update.Output.PreviousVersions) != 0 {
+		t.Fatal("expected random to keep the same identity without previous versions")
+	}
+	if update.Output.IsExpired {
+		t.Fatal("expected the rotation to restart")
+	}
+	diff, err := Identity{}.Diff(ctx, infer.DiffRequest[IdentityArgs, IdentityState]{ID: state.Recipient, Inputs: args, State: update.Output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.HasChanges {
+		t.Fatalf("expected no changes after the expiry driven update, got %v", diff.DetailedDiff)
+	}
+}
+
+func TestIdentityCheck(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		name   string
+		inputs property.Map
+		want   []string
+	}{
+		{name: "empty", inputs: property.NewMap(nil)},
+		{name: "random", inputs: property.NewMap(map[string]property.Value{"random": property.New(random)})},
+		{name: "short random", inputs: property.NewMap(map[string]property.Value{"random": property.New("AAAA")}), want: []string{"random"}},
+		{name: "random not base64", inputs: property.NewMap(map[string]property.Value{"random": property.New("not base64!")}), want: []string{"random"}},
+		{name: "unknown random", inputs: property.NewMap(map[string]property.Value{"random": property.New(property.Computed)})},
+		{name: "private key", inputs: property.NewMap(map[string]property.Value{"privateKey": property.New(x25519.String())})},
+		{name: "invalid private key", inputs: property.NewMap(map[string]property.Value{"privateKey": property.New("AGE-SECRET-KEY-1")}), want: []string{"privateKey"}},
+		{name: "private key of another type", inputs: property.NewMap(map[string]property.Value{
+			"privateKey": property.New(x25519.String()),
+			"keyType":    property.New(KeyTypeMLKEM768X25519),
+		}), want: []string{"privateKey"}},
+		{name: "random and private key", inputs: property.NewMap(map[string]property.Value{
+			"random":     property.New(random),
+			"privateKey": property.New(x25519.String()),
+		}), want: []string{"privateKey"}},
+		{name: "unknown key type", inputs: property.NewMap(map[string]property.Value{"keyType": property.New("RSA")}), want: []string{"keyType"}},
+		{name: "derivation", inputs: property.NewMap(map[string]property.Value{"derivation": property.New(map[string]property.Value{
+			"master": property.New("secret"),
+			"label":  property.New("app"),
+		})})},
+		{name: "derivation master not hex", inputs: property.NewMap(map[string]property.Value{"derivation": property.New(map[string]property.Value{
+			"master":         property.New("secret"),
+			"masterEncoding": property.New("hex"),
+			"label":          property.New("app"),
+		})}), want: []string{"derivation.master"}},
+		{name: "derivation unknown hash", inputs: property.NewMap(map[string]property.Value{"derivation": property.New(map[string]property.Value{
+			"master": property.New("secret"),
+			"label":  property.New("app"),
+			"hash":   property.New("MD5"),
+		})}), want: []string{"derivation.hash"}},
+		{name: "derivation unknown master", inputs: property.NewMap(map[string]property.Value{"derivation": property.New(map[string]property.Value{
+			"master": property.New(property.Computed),
+			"label":  property.New("app"),
+		})})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Identity{}.Check(context.Background(), infer.CheckRequest{NewInputs: tt.inputs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Failures) != len(tt.want) {
+				t.Fatalf("got failures %v, want failures on %v", resp.Failures, tt.want)
+			}
+			for i, f := range resp.Failures {
+				if f.Property != tt.want[i] {
+					t.Fatalf("got failure on %s, want %s", f.Property, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIdentityDerivation(t *testing.T) {
+	master := "secret master key material"
+	create := func(args IdentityArgs) IdentityState {
+		t.Helper()
+		resp, err := Identity{}.Create(context.Background(), infer.CreateRequest[IdentityArgs]{Inputs: args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Output
+	}
+
+	a := create(IdentityArgs{Derivation: &derive.Derivation{Master: master, Label: "app"}})
+	b := create(IdentityArgs{Derivation: &derive.Derivation{Master: master, Label: "app"}})
+	if a.PrivateKey != b.PrivateKey {
+		t.Fatal("expected the same master and label to derive the same identity")
+	}
+	if c := create(IdentityArgs{Derivation: &derive.Derivation{Master: master, Label: "db"}}); c.PrivateKey == a.PrivateKey {
+		t.Fatal("expected distinct labels to derive distinct identities")
+	}
+	if pq := create(IdentityArgs{KeyType: KeyTypeMLKEM768X25519, Derivation: &derive.Derivation{Master: master, Label: "app"}}); !strings.HasPrefix(pq.Recipient, "age1pq1") {
+		t.Fatalf("expected a post-quantum recipient, got %s", pq.Recipient)
+	}
+
+	_, err := Identity{}.Create(context.Background(), infer.CreateRequest[IdentityArgs]{Inputs: IdentityArgs{
+		Random:     base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		Derivation: &derive.Derivation{Master: master, Label: "app"},
+	}})
+	if err == nil {
+		t.Fatal("expected random and derivation to conflict")
+	}
+}
+
+func TestIdentityImport(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq, err := age.GenerateHybridIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		id      string
+		inputs  IdentityArgs
+		key     string
+		keyType string
+		wantErr bool
+	}{
+		{name: "by id", id: x25519.String(), key: x25519.String()},
+		{name: "post-quantum by id", id: pq.String(), key: pq.String(), keyType: KeyTypeMLKEM768X25519},
+		{name: "privateKey input", id: x25519.Recipient().String(), inputs: IdentityArgs{ExistingKey: x25519.String()}, key: x25519.String()},
+		{name: "id without private key", id: x25519.Recipient().String(), wantErr: true},
+		{name: "malformed id", id: "AGE-SECRET-KEY-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Identity{}.Read(context.Background(), infer.ReadRequest[IdentityArgs, IdentityState]{ID: tt.id, Inputs: tt.inputs})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected import to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.State.PrivateKey != tt.key || resp.ID != resp.State.Recipient {
+				t.Fatalf("imported %s as %s, expected %s", resp.State.PrivateKey, resp.ID, tt.key)
+			}
+			if resp.Inputs.KeyType != tt.keyType {
+				t.Fatalf("got keyType %q, want %q", resp.Inputs.KeyType, tt.keyType)
+			}
+			// the imported inputs must pass Check, or the next update fails
+			inputs := map[string]property.Value{"privateKey": property.New(resp.Inputs.ExistingKey)}
+			if len(resp.Inputs.KeyType) > 0 {
+				inputs["keyType"] = property.New(resp.Inputs.KeyType)
+			}
+			check, err := Identity{}.Check(context.Background(), infer.CheckRequest{NewInputs: property.NewMap(inputs)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(check.Failures) > 0 {
+				t.Fatalf("unexpected failures %v", check.Failures)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package age
+
+import (
+	"errors"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// match records which identity and recipient stanza of the header opened a file.
+type match struct {
+	recipient string
+	stanza    string
+	index     int
+}
+
+// matchingIdentity wraps an identity tried on decrypt, recording the match when it
+// unwraps the file key.
+type matchingIdentity struct {
+	age.Identity
+	recipient string
+	match     *match
+}
+
+// Unwrap tries the identity on one stanza at a time, like age's own identities do, so the
+// stanza that opened the file is known without unwrapping it twice.
+func (i matchingIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		// unwrapping a single stanza would hide an scrypt stanza mixed with others from
+		// the scrypt identity, which refuses to decrypt such a file
+		if s.Type == "scrypt" && len(stanzas) != 1 {
+			return nil, errors.New("an scrypt recipient must be the only one")
+		}
+	}
+	err := age.ErrIncorrectIdentity
+	for n, s := range stanzas {
+		var fileKey []byte
+		fileKey, err = i.Identity.Unwrap([]*age.Stanza{s})
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*i.match = match{recipient: i.recipient, stanza: s.Type, index: n}
+		return fileKey, nil
+	}
+	return nil, err
+}
+
+// parseIdentities parses an identity file, which may hold several native age identities
+// and comments, or a single OpenSSH private key.
+func parseIdentities(s, sshPassphrase string, m *match) ([]age.Identity, error) {
+	if isSSHIdentity(s) {
+		identity, recipient, err := parseSSHIdentity([]byte(s), sshPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{matchingIdentity{identity, recipient, m}}, nil
+	}
+	parsed, err := age.ParseIdentities(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]age.Identity, 0, len(parsed))
+	for _, i := range parsed {
+		_, recipient := encodeIdentity(i)
+		identities = append(identities, matchingIdentity{i, recipient, m})
+	}
+	return identities, nil
+}
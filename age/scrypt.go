@@ -0,0 +1,35 @@
+package age
+
+import (
+	"fmt"
+
+	"filippo.io/age"
+)
+
+// validWorkFactor reports whether logN is accepted by age's scrypt recipient and identity,
+// 0 means the age default is used.
+func validWorkFactor(logN int) bool {
+	return logN >= 0 && logN <= 30
+}
+
+func newScryptRecipient(passphrase string, workFactor int) (age.Recipient, error) {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create passphrase recipient: %s", err)
+	}
+	if workFactor > 0 {
+		r.SetWorkFactor(workFactor)
+	}
+	return r, nil
+}
+
+func newScryptIdentity(passphrase string, maxWorkFactor int) (age.Identity, error) {
+	i, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create passphrase identity: %s", err)
+	}
+	if maxWorkFactor > 0 {
+		i.SetMaxWorkFactor(maxWorkFactor)
+	}
+	return i, nil
+}
@@ -0,0 +1,63 @@
+package age
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// parseRecipients parses native age recipients as well as ssh-ed25519 and ssh-rsa public keys.
+func parseRecipients(s string) ([]age.Recipient, error) {
+	if !strings.HasPrefix(s, "ssh-") {
+		return age.ParseRecipients(strings.NewReader(s))
+	}
+	r, err := agessh.ParseRecipient(s)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Recipient{r}, nil
+}
+
+func isSSHIdentity(s string) bool {
+	return strings.Contains(s, "-----BEGIN")
+}
+
+// parseSSHIdentity parses an ed25519 or RSA OpenSSH private key, decrypting it with
+// passphrase when it is passphrase protected. The ssh public key is returned as recipient.
+func parseSSHIdentity(pemBytes []byte, passphrase string) (age.Identity, string, error) {
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if len(passphrase) == 0 {
+			return nil, "", fmt.Errorf("ssh identity is passphrase protected, identityPassphrase is required")
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse ssh identity: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse ssh identity: %s", err)
+	}
+	recipient := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	var identity age.Identity
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		identity, err = agessh.NewEd25519Identity(*k)
+	case ed25519.PrivateKey:
+		identity, err = agessh.NewEd25519Identity(k)
+	case *rsa.PrivateKey:
+		identity, err = agessh.NewRSAIdentity(k)
+	default:
+		return nil, "", fmt.Errorf("unsupported ssh identity type: %T", key)
+	}
+	return identity, recipient, err
+}
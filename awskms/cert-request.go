@@ -0,0 +1,139 @@
+package awskms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type CertRequest struct{}
+
+func (f *CertRequest) Annotate(a infer.Annotator) {
+	a.Describe(&f, "A certificate signing request for a KMS key whose private key never leaves KMS, to be signed by a LocallySignedCert or any other certificate authority")
+}
+
+type CertRequestArgs struct {
+	CertIdentity
+	KeyId            string                     `pulumi:"keyId"`
+	SigningAlgorithm types.SigningAlgorithmSpec `pulumi:"signingAlgorithm,optional"`
+}
+
+func (f *CertRequestArgs) Annotate(a infer.Annotator) {
+	a.Describe(&f.KeyId, "The asymmetric KMS key to request a certificate for, it signs the request. Its key usage must be SIGN_VERIFY.")
+	a.Describe(&f.SigningAlgorithm, "The KMS signing algorithm the request is signed with, it must be supported by the key. Default is RSASSA_PKCS1_V1_5_SHA_256 for RSA keys and the ECDSA algorithm matching the curve for ECC keys.")
+}
+
+type CertRequestState struct {
+	CertRequestArgs
+	CertRequestPem string `pulumi:"certRequestPem"`
+}
+
+func (f *CertRequestState) Annotate(a infer.Annotator) {
+	a.Describe(&f.CertRequestPem, "The PEM encoded certificate signing request.")
+}
+
+func (CertRequest) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[CertRequestArgs], error) {
+	args, failures, err := infer.DefaultCheck[CertRequestArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[CertRequestArgs]{}, err
+	}
+	if check.Known(req.NewInputs, "keyId") {
+		failures = append(failures, check.NotEmpty("keyId", args.KeyId)...)
+	}
+	failures = append(failures, args.CertIdentity.validate(req.NewInputs)...)
+	if check.Known(req.NewInputs, "signingAlgorithm") && len(args.SigningAlgorithm) > 0 {
+		failures = append(failures, check.Enum("signingAlgorithm", args.SigningAlgorithm, certSigningAlgorithmValues())...)
+	}
+	return infer.CheckResponse[CertRequestArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (CertRequest) Create(ctx context.Context, req infer.CreateRequest[CertRequestArgs]) (resp infer.CreateResponse[CertRequestState], err error) {
+	if req.DryRun {
+		return
+	}
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	s, err := newSigner(ctx, svc, req.Inputs.KeyId, req.Inputs.SigningAlgorithm)
+	if err != nil {
+		return
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:            req.Inputs.Subject.name(),
+		DNSNames:           req.Inputs.DnsNames,
+		IPAddresses:        req.Inputs.ips(),
+		EmailAddresses:     req.Inputs.EmailAddresses,
+		SignatureAlgorithm: s.signatureAlgorithm(),
+	}
+	if template.URIs, err = req.Inputs.uris(); err != nil {
+		return
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, s)
+	if err != nil {
+		return resp, fmt.Errorf("failed to sign certificate request with %s: %w", req.Inputs.KeyId, err)
+	}
+	return infer.CreateResponse[CertRequestState]{
+		ID: req.Name,
+		Output: CertRequestState{
+			req.Inputs,
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})),
+		},
+	}, nil
+}
+
+func (CertRequest) Read(ctx context.Context, req infer.ReadRequest[CertRequestArgs, CertRequestState]) (resp infer.ReadResponse[CertRequestArgs, CertRequestState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.KeyId); err != nil {
+		return
+	}
+	if _, err = parseCertRequestPem(req.State.CertRequestPem); err != nil {
+		return resp, fmt.Errorf("certRequestPem of %s %s", req.ID, err)
+	}
+	return infer.ReadResponse[CertRequestArgs, CertRequestState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  req.State,
+	}, nil
+}
+
+func (CertRequest) Delete(ctx context.Context, req infer.DeleteRequest[CertRequestState]) (infer.DeleteResponse, error) {
+	return infer.DeleteResponse{}, nil
+}
+
+func (CertRequest) Diff(ctx context.Context, req infer.DiffRequest[CertRequestArgs, CertRequestState]) (infer.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+	if req.Inputs.KeyId != req.State.KeyId {
+		diff["keyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.SigningAlgorithm != req.State.SigningAlgorithm {
+		diff["signingAlgorithm"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	req.Inputs.CertIdentity.diff(req.State.CertIdentity, diff)
+	return infer.DiffResponse{
+		DeleteBeforeReplace: false,
+		HasChanges:          len(diff) > 0,
+		DetailedDiff:        diff,
+	}, nil
+}
+
+func (CertRequest) WireDependencies(f infer.FieldSelector, args *CertRequestArgs, state *CertRequestState) {
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.KeyId))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.SigningAlgorithm))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.Subject))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.DnsNames))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.IpAddresses))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.Uris))
+	f.OutputField(&state.CertRequestPem).DependsOn(f.InputField(&args.EmailAddresses))
+}
@@ -0,0 +1,302 @@
+package awskms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+// Subject is the distinguished name a certificate or certificate request is issued to.
+type Subject struct {
+	CommonName         string   `pulumi:"commonName,optional"`
+	Organization       string   `pulumi:"organization,optional"`
+	OrganizationalUnit string   `pulumi:"organizationalUnit,optional"`
+	Country            string   `pulumi:"country,optional"`
+	Province           string   `pulumi:"province,optional"`
+	Locality           string   `pulumi:"locality,optional"`
+	StreetAddress      []string `pulumi:"streetAddress,optional"`
+	PostalCode         string   `pulumi:"postalCode,optional"`
+	SerialNumber       string   `pulumi:"serialNumber,optional"`
+}
+
+func (f *Subject) Annotate(a infer.Annotator) {
+	a.Describe(&f.CommonName, "Distinguished name: CN")
+	a.Describe(&f.Organization, "Distinguished name: O")
+	a.Describe(&f.OrganizationalUnit, "Distinguished name: OU")
+	a.Describe(&f.Country, "Distinguished name: C")
+	a.Describe(&f.Province, "Distinguished name: ST")
+	a.Describe(&f.Locality, "Distinguished name: L")
+	a.Describe(&f.StreetAddress, "Distinguished name: STREET")
+	a.Describe(&f.PostalCode, "Distinguished name: PC")
+	a.Describe(&f.SerialNumber, "Distinguished name: SERIALNUMBER")
+}
+
+func (f *Subject) name() pkix.Name {
+	if f == nil {
+		return pkix.Name{}
+	}
+	return pkix.Name{
+		CommonName:         f.CommonName,
+		Organization:       optionalList(f.Organization),
+		OrganizationalUnit: optionalList(f.OrganizationalUnit),
+		Country:            optionalList(f.Country),
+		Province:           optionalList(f.Province),
+		Locality:           optionalList(f.Locality),
+		StreetAddress:      f.StreetAddress,
+		PostalCode:         optionalList(f.PostalCode),
+		SerialNumber:       f.SerialNumber,
+	}
+}
+
+func optionalList(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return []string{s}
+}
+
+// CertIdentity is who a certificate or certificate request is issued to, its subject and
+// subject alternative names.
+type CertIdentity struct {
+	Subject        *Subject `pulumi:"subject,optional"`
+	DnsNames       []string `pulumi:"dnsNames,optional"`
+	IpAddresses    []string `pulumi:"ipAddresses,optional"`
+	Uris           []string `pulumi:"uris,optional"`
+	EmailAddresses []string `pulumi:"emailAddresses,optional"`
+}
+
+func (f *CertIdentity) Annotate(a infer.Annotator) {
+	a.Describe(&f.Subject, "The subject the certificate is issued to.")
+	a.Describe(&f.DnsNames, "DNS names the certificate is valid for.")
+	a.Describe(&f.IpAddresses, "IP addresses the certificate is valid for.")
+	a.Describe(&f.Uris, "URIs the certificate is valid for, e.g. SPIFFE IDs.")
+	a.Describe(&f.EmailAddresses, "Email addresses the certificate is valid for.")
+}
+
+// validate checks the subject alternative names known in inputs.
+func (f CertIdentity) validate(inputs property.Map) []p.CheckFailure {
+	var failures []p.CheckFailure
+	if check.Known(inputs, "ipAddresses") {
+		for i, ip := range f.IpAddresses {
+			if net.ParseIP(ip) == nil {
+				failures = append(failures, p.CheckFailure{Property: fmt.Sprintf("ipAddresses[%d]", i), Reason: fmt.Sprintf("%q is not an IP address", ip)})
+			}
+		}
+	}
+	if check.Known(inputs, "uris") {
+		for i, uri := range f.Uris {
+			if u, err := url.Parse(uri); err != nil || !u.IsAbs() {
+				failures = append(failures, p.CheckFailure{Property: fmt.Sprintf("uris[%d]", i), Reason: fmt.Sprintf("%q is not an absolute URI", uri)})
+			}
+		}
+	}
+	return failures
+}
+
+func (f CertIdentity) ips() []net.IP {
+	var ips []net.IP
+	for _, ip := range f.IpAddresses {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	return ips
+}
+
+func (f CertIdentity) uris() ([]*url.URL, error) {
+	var uris []*url.URL
+	for _, uri := range f.Uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a URI: %w", uri, err)
+		}
+		uris = append(uris, u)
+	}
+	return uris, nil
+}
+
+// diff records changes of the identity in diff, a certificate can't change who it is
+// issued to so every change replaces it.
+func (f CertIdentity) diff(olds CertIdentity, diff map[string]p.PropertyDiff) {
+	if f.Subject.name().String() != olds.Subject.name().String() {
+		diff["subject"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !slices.Equal(f.DnsNames, olds.DnsNames) {
+		diff["dnsNames"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !slices.Equal(f.IpAddresses, olds.IpAddresses) {
+		diff["ipAddresses"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !slices.Equal(f.Uris, olds.Uris) {
+		diff["uris"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !slices.Equal(f.EmailAddresses, olds.EmailAddresses) {
+		diff["emailAddresses"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+}
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digital_signature":  x509.KeyUsageDigitalSignature,
+	"content_commitment": x509.KeyUsageContentCommitment,
+	"key_encipherment":   x509.KeyUsageKeyEncipherment,
+	"data_encipherment":  x509.KeyUsageDataEncipherment,
+	"key_agreement":      x509.KeyUsageKeyAgreement,
+	"cert_signing":       x509.KeyUsageCertSign,
+	"crl_signing":        x509.KeyUsageCRLSign,
+	"encipher_only":      x509.KeyUsageEncipherOnly,
+	"decipher_only":      x509.KeyUsageDecipherOnly,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any_extended":                      x509.ExtKeyUsageAny,
+	"server_auth":                       x509.ExtKeyUsageServerAuth,
+	"client_auth":                       x509.ExtKeyUsageClientAuth,
+	"code_signing":                      x509.ExtKeyUsageCodeSigning,
+	"email_protection":                  x509.ExtKeyUsageEmailProtection,
+	"ipsec_end_system":                  x509.ExtKeyUsageIPSECEndSystem,
+	"ipsec_tunnel":                      x509.ExtKeyUsageIPSECTunnel,
+	"ipsec_user":                        x509.ExtKeyUsageIPSECUser,
+	"timestamping":                      x509.ExtKeyUsageTimeStamping,
+	"ocsp_signing":                      x509.ExtKeyUsageOCSPSigning,
+	"microsoft_server_gated_crypto":     x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"netscape_server_gated_crypto":      x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"microsoft_commercial_code_signing": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"microsoft_kernel_code_signing":     x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+func allowedUseValues() []string {
+	var values []string
+	for use := range keyUsages {
+		values = append(values, use)
+	}
+	for use := range extKeyUsages {
+		values = append(values, use)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// CertOptions are how a certificate may be used and how it is signed.
+type CertOptions struct {
+	AllowedUses      []string                   `pulumi:"allowedUses"`
+	IsCaCertificate  bool                       `pulumi:"isCaCertificate,optional"`
+	SigningAlgorithm types.SigningAlgorithmSpec `pulumi:"signingAlgorithm,optional"`
+}
+
+func (f *CertOptions) Annotate(a infer.Annotator) {
+	a.Describe(&f.AllowedUses, "The key usages and extended key usages the certificate is valid for, with the same names as the tls provider, e.g. cert_signing | crl_signing | digital_signature | key_encipherment | server_auth | client_auth.")
+	a.Describe(&f.IsCaCertificate, "Whether the certificate is a certificate authority that can sign other certificates. Default is false.")
+	a.Describe(&f.SigningAlgorithm, "The KMS signing algorithm the certificate is signed with, it must be supported by the signing key. RSASSA_PSS_SHA_256 | RSASSA_PSS_SHA_384 | RSASSA_PSS_SHA_512 | RSASSA_PKCS1_V1_5_SHA_256 | RSASSA_PKCS1_V1_5_SHA_384 | RSASSA_PKCS1_V1_5_SHA_512 | ECDSA_SHA_256 | ECDSA_SHA_384 | ECDSA_SHA_512. "+
+		"Default is RSASSA_PKCS1_V1_5_SHA_256 for RSA keys and the ECDSA algorithm matching the curve for ECC keys.")
+}
+
+// validate checks the options known in inputs, along with the rotation args whose
+// validityPeriodHours a certificate requires.
+func (f CertOptions) validate(ctx context.Context, inputs property.Map, args rotation.Args) []p.CheckFailure {
+	failures := rotation.Validate(args, rotation.Now(ctx))
+	if args.ValidityPeriodHours == 0 && (check.Known(inputs, "validityPeriodHours") || !check.Set(inputs, "validityPeriodHours")) {
+		failures = append(failures, p.CheckFailure{Property: "validityPeriodHours", Reason: "must be set, a certificate always expires"})
+	}
+	if check.Known(inputs, "allowedUses") {
+		for i, use := range f.AllowedUses {
+			failures = append(failures, check.Enum(fmt.Sprintf("allowedUses[%d]", i), use, allowedUseValues())...)
+		}
+	}
+	if check.Known(inputs, "signingAlgorithm") && len(f.SigningAlgorithm) > 0 {
+		failures = append(failures, check.Enum("signingAlgorithm", f.SigningAlgorithm, certSigningAlgorithmValues())...)
+	}
+	return failures
+}
+
+// diff records changes of the options in diff, along with the rotation args. Unlike the
+// keys of other resources the validity of a certificate is part of it, so changing
+// validityPeriodHours replaces it.
+func (f CertOptions) diff(ctx context.Context, id string, olds CertOptions, news, oldArgs rotation.Args, state rotation.State, diff map[string]p.PropertyDiff) {
+	if !slices.Equal(f.AllowedUses, olds.AllowedUses) {
+		diff["allowedUses"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if f.IsCaCertificate != olds.IsCaCertificate {
+		diff["isCaCertificate"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if f.SigningAlgorithm != olds.SigningAlgorithm {
+		diff["signingAlgorithm"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	rotation.Diff(ctx, id, news, oldArgs, state, diff)
+	if _, ok := diff["validityPeriodHours"]; ok {
+		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+}
+
+// template returns the certificate template for the options, valid for the rotation state.
+func (f CertOptions) template(state rotation.State) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	notAfter, err := time.Parse(time.RFC3339, state.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("certificate has no expiry: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		NotBefore:             time.Unix(state.Created, 0),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  f.IsCaCertificate,
+	}
+	for _, use := range f.AllowedUses {
+		if usage, ok := keyUsages[use]; ok {
+			template.KeyUsage |= usage
+		} else if usage, ok := extKeyUsages[use]; ok {
+			template.ExtKeyUsage = append(template.ExtKeyUsage, usage)
+		} else {
+			return nil, fmt.Errorf("unknown allowed use %q", use)
+		}
+	}
+	return template, nil
+}
+
+// certPem PEM encodes a DER certificate.
+func certPem(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// parseCertPem parses the single certificate in a PEM string.
+func parseCertPem(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("is not a PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parseCertRequestPem parses the certificate request in a PEM string and checks that it is
+// signed by the key it requests a certificate for.
+func parseCertRequestPem(s string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("is not a PEM encoded certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("has an invalid signature: %w", err)
+	}
+	return csr, nil
+}
@@ -0,0 +1,280 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/kmstest"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+// signingKey makes keyId an asymmetric key of the spec algorithm implies, the local key
+// store creates the key pair on first sign.
+func signingKey(t *testing.T, fake *kmstest.KMS, keyId string, algorithm types.SigningAlgorithmSpec) {
+	t.Helper()
+	if _, err := fake.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String(keyId),
+		Message:          []byte("init"),
+		SigningAlgorithm: algorithm,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// list is a property array of strings.
+func list(values ...string) property.Value {
+	arr := make([]property.Value, len(values))
+	for i, v := range values {
+		arr[i] = property.New(v)
+	}
+	return property.New(arr)
+}
+
+func subject(commonName string) property.Value {
+	return property.New(property.NewMap(map[string]property.Value{
+		"commonName":   property.New(commonName),
+		"organization": property.New("ACME Examples, Inc"),
+	}))
+}
+
+func TestCertificateChain(t *testing.T) {
+	server, fake := newServer(t)
+	signingKey(t, fake, "alias/ca", types.SigningAlgorithmSpecEcdsaSha384)
+	signingKey(t, fake, "alias/server", types.SigningAlgorithmSpecEcdsaSha256)
+
+	ca := newResource(t, server, "keygen:awskms:SelfSignedCert")
+	caInputs := map[string]property.Value{
+		"keyId":               property.New("alias/ca"),
+		"subject":             subject("ACME Root CA"),
+		"isCaCertificate":     property.New(true),
+		"allowedUses":         list("cert_signing", "crl_signing"),
+		"validityPeriodHours": property.New(24.0 * 365),
+	}
+	caState := ca.create(caInputs)
+	caCert, err := parseCertPem(str(t, caState, "certPem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caCert.IsCA || caCert.Subject.CommonName != "ACME Root CA" || caCert.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Fatalf("unexpected CA certificate %v signed with %s", caCert.Subject, caCert.SignatureAlgorithm)
+	}
+	if err := caCert.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("expected the CA certificate to be self-signed: %s", err)
+	}
+	if got := caCert.NotAfter.Sub(caCert.NotBefore); got != 24*365*time.Hour {
+		t.Fatalf("expected the CA to be valid for validityPeriodHours, got %s", got)
+	}
+
+	csr := newResource(t, server, "keygen:awskms:CertRequest")
+	csrState := csr.create(map[string]property.Value{
+		"keyId":       property.New("alias/server"),
+		"subject":     subject("example.com"),
+		"dnsNames":    list("example.com", "www.example.com"),
+		"ipAddresses": list("127.0.0.1"),
+		"uris":        list("spiffe://example.com/server"),
+	})
+
+	cert := newResource(t, server, "keygen:awskms:LocallySignedCert")
+	certInputs := map[string]property.Value{
+		"certRequestPem":      csrState.Get("certRequestPem"),
+		"caCertPem":           caState.Get("certPem"),
+		"caKeyId":             property.New("alias/ca"),
+		"allowedUses":         list("digital_signature", "server_auth"),
+		"validityPeriodHours": property.New(24.0),
+	}
+	certState := cert.create(certInputs)
+	leaf, err := parseCertPem(str(t, certState, "certPem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:     "www.example.com",
+		Roots:       roots,
+		CurrentTime: leaf.NotBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		t.Fatalf("expected the certificate to chain to the CA: %s", err)
+	}
+	if leaf.IsCA || leaf.Subject.CommonName != "example.com" || len(leaf.IPAddresses) != 1 || len(leaf.URIs) != 1 {
+		t.Fatalf("expected the certificate to be issued to the request, got %v %v %v", leaf.Subject, leaf.IPAddresses, leaf.URIs)
+	}
+	public, err := fake.GetPublicKey(context.Background(), &kms.GetPublicKeyInput{KeyId: aws.String("alias/server")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if der, _ := x509.MarshalPKIXPublicKey(leaf.PublicKey); string(der) != string(public.PublicKey) {
+		t.Fatal("expected the certificate to be issued to the key of the request")
+	}
+
+	if diff := cert.diff(certInputs); diff.HasChanges {
+		t.Fatalf("expected no changes, got %v", diff.DetailedDiff)
+	}
+	if _, err := cert.read(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	fake.SetKeyState("alias/ca", types.KeyStateDisabled)
+	if _, err := cert.read(); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("expected read of a disabled CA key to fail, got %v", err)
+	}
+	cert.delete()
+	csr.delete()
+	ca.delete()
+}
+
+func TestSelfSignedCertDiff(t *testing.T) {
+	created := time.Now()
+	now := created
+	server, fake := newServerContext(t, rotation.WithClock(context.Background(), func() time.Time { return now }))
+	signingKey(t, fake, "alias/ca", types.SigningAlgorithmSpecEcdsaSha256)
+
+	r := newResource(t, server, "keygen:awskms:SelfSignedCert")
+	inputs := func(extra map[string]property.Value) map[string]property.Value {
+		inputs := map[string]property.Value{
+			"keyId":               property.New("alias/ca"),
+			"subject":             subject("ACME Root CA"),
+			"allowedUses":         list("cert_signing"),
+			"isCaCertificate":     property.New(true),
+			"validityPeriodHours": property.New(48.0),
+		}
+		for k, v := range extra {
+			inputs[k] = v
+		}
+		return inputs
+	}
+	state := r.create(inputs(nil))
+	certPem := str(t, state, "certPem")
+
+	tests := []struct {
+		name  string
+		extra map[string]property.Value
+		want  map[string]p.DiffKind
+	}{
+		{name: "subject", extra: map[string]property.Value{"subject": subject("ACME Root CA 2")}, want: map[string]p.DiffKind{"subject": p.UpdateReplace}},
+		{name: "dns names", extra: map[string]property.Value{"dnsNames": list("example.com")}, want: map[string]p.DiffKind{"dnsNames": p.UpdateReplace}},
+		{name: "allowed uses", extra: map[string]property.Value{"allowedUses": list("cert_signing", "crl_signing")}, want: map[string]p.DiffKind{"allowedUses": p.UpdateReplace}},
+		{name: "signing algorithm", extra: map[string]property.Value{"signingAlgorithm": property.New("ECDSA_SHA_256")}, want: map[string]p.DiffKind{"signingAlgorithm": p.UpdateReplace}},
+		{name: "validity", extra: map[string]property.Value{"validityPeriodHours": property.New(72.0)}, want: map[string]p.DiffKind{"validityPeriodHours": p.UpdateReplace}},
+		{name: "early renewal", extra: map[string]property.Value{"earlyRenewalHours": property.New(12.0)}, want: map[string]p.DiffKind{"earlyRenewalHours": p.Update}},
+		{name: "triggers", extra: map[string]property.Value{"triggers": property.New(property.NewMap(map[string]property.Value{"incident": property.New("42")}))}, want: map[string]p.DiffKind{"triggers": p.UpdateReplace}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffKinds(r.diff(inputs(tt.extra)))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got diff %v, want %v", got, tt.want)
+			}
+			for k, kind := range tt.want {
+				if got[k] != kind {
+					t.Fatalf("got diff %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	state = r.update(inputs(map[string]property.Value{"earlyRenewalHours": property.New(12.0)}))
+	if str(t, state, "certPem") != certPem {
+		t.Fatal("expected update to keep the certificate")
+	}
+	now = created.Add(37 * time.Hour)
+	if got := diffKinds(r.diff(inputs(map[string]property.Value{"earlyRenewalHours": property.New(12.0)}))); got["expired"] != p.UpdateReplace {
+		t.Fatalf("expected the certificate to be renewed within earlyRenewalHours of expiry, got %v", got)
+	}
+}
+
+func TestCertSigningAlgorithm(t *testing.T) {
+	server, fake := newServer(t)
+	signingKey(t, fake, "alias/rsa", types.SigningAlgorithmSpecRsassaPssSha256)
+
+	for algorithm, want := range map[string]x509.SignatureAlgorithm{
+		"":                   x509.SHA256WithRSA,
+		"RSASSA_PSS_SHA_384": x509.SHA384WithRSAPSS,
+	} {
+		t.Run(want.String(), func(t *testing.T) {
+			inputs := map[string]property.Value{
+				"keyId":               property.New("alias/rsa"),
+				"subject":             subject("ACME Root CA"),
+				"allowedUses":         list("cert_signing"),
+				"validityPeriodHours": property.New(24.0),
+			}
+			if algorithm != "" {
+				inputs["signingAlgorithm"] = property.New(algorithm)
+			}
+			state := newResource(t, server, "keygen:awskms:SelfSignedCert").create(inputs)
+			cert, err := parseCertPem(str(t, state, "certPem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.SignatureAlgorithm != want {
+				t.Fatalf("expected %s, got %s", want, cert.SignatureAlgorithm)
+			}
+			if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSigner(t *testing.T) {
+	ctx := context.Background()
+	fake := kmstest.New()
+	signingKey(t, fake, "alias/ecdsa", types.SigningAlgorithmSpecEcdsaSha256)
+	if _, err := fake.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String("alias/symmetric"), Plaintext: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newSigner(ctx, fake, "alias/symmetric", ""); err == nil {
+		t.Fatal("expected a symmetric key not to sign certificates")
+	}
+	if _, err := newSigner(ctx, fake, "alias/ecdsa", types.SigningAlgorithmSpecRsassaPssSha256); err == nil || !strings.Contains(err.Error(), "ECDSA_SHA_256") {
+		t.Fatalf("expected an ECC key not to sign with RSA, got %v", err)
+	}
+	s, err := newSigner(ctx, fake, "alias/ecdsa", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(nil, make([]byte, 48), crypto.SHA384); err == nil {
+		t.Fatal("expected the signer to refuse another hash than its signing algorithm")
+	}
+}
+
+func TestLocallySignedCertWrongCaKey(t *testing.T) {
+	server, fake := newServer(t)
+	signingKey(t, fake, "alias/ca", types.SigningAlgorithmSpecEcdsaSha256)
+	signingKey(t, fake, "alias/other", types.SigningAlgorithmSpecEcdsaSha256)
+
+	ca := newResource(t, server, "keygen:awskms:SelfSignedCert").create(map[string]property.Value{
+		"keyId":               property.New("alias/ca"),
+		"subject":             subject("ACME Root CA"),
+		"isCaCertificate":     property.New(true),
+		"allowedUses":         list("cert_signing"),
+		"validityPeriodHours": property.New(24.0),
+	})
+	csr := newResource(t, server, "keygen:awskms:CertRequest").create(map[string]property.Value{
+		"keyId":   property.New("alias/other"),
+		"subject": subject("example.com"),
+	})
+
+	r := newResource(t, server, "keygen:awskms:LocallySignedCert")
+	checked := r.check(map[string]property.Value{
+		"certRequestPem":      csr.Get("certRequestPem"),
+		"caCertPem":           ca.Get("certPem"),
+		"caKeyId":             property.New("alias/other"),
+		"allowedUses":         list("server_auth"),
+		"validityPeriodHours": property.New(24.0),
+	})
+	_, err := server.Create(p.CreateRequest{Urn: r.urn, Properties: checked})
+	if err == nil || !strings.Contains(err.Error(), "does not hold the private key") {
+		t.Fatalf("expected signing with another key than the CA's to fail, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package awskms
+
+import (
+	"context"
+	"testing"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func properties(failures []p.CheckFailure) []string {
+	props := make([]string, len(failures))
+	for i, f := range failures {
+		props[i] = f.Property
+	}
+	return props
+}
+
+func TestCheck(t *testing.T) {
+	keyId := property.New("alias/keygen")
+	tests := []struct {
+		name   string
+		check  func(property.Map) ([]p.CheckFailure, error)
+		inputs map[string]property.Value
+		want   []string
+	}{
+		{name: "random", check: checkRandom, inputs: map[string]property.Value{"numberOfBytes": property.New(32.0)}},
+		{name: "random too large", check: checkRandom, inputs: map[string]property.Value{"numberOfBytes": property.New(1025.0)}, want: []string{"numberOfBytes"}},
+		{name: "random empty", check: checkRandom, inputs: map[string]property.Value{"numberOfBytes": property.New(0.0)}, want: []string{"numberOfBytes"}},
+		{name: "random unknown", check: checkRandom, inputs: map[string]property.Value{"numberOfBytes": property.New(property.Computed)}},
+		{name: "data key", check: checkDataKey, inputs: map[string]property.Value{"keyId": keyId, "keySpec": property.New("AES_256")}},
+		{name: "data key unknown spec", check: checkDataKey, inputs: map[string]property.Value{"keyId": keyId, "keySpec": property.New("AES_512")}, want: []string{"keySpec"}},
+		{name: "data key spec and bytes", check: checkDataKey, inputs: map[string]property.Value{
+			"keyId":         keyId,
+			"keySpec":       property.New("AES_256"),
+			"numberOfBytes": property.New(32.0),
+		}, want: []string{"numberOfBytes"}},
+		{name: "data key bytes", check: checkDataKey, inputs: map[string]property.Value{"keyId": keyId, "numberOfBytes": property.New(64.0)}},
+		{name: "data key without spec or bytes", check: checkDataKey, inputs: map[string]property.Value{"keyId": keyId}, want: []string{"keySpec"}},
+		{name: "data key empty key id", check: checkDataKey, inputs: map[string]property.Value{"keyId": property.New(""), "keySpec": property.New("AES_256")}, want: []string{"keyId"}},
+		{name: "data key pair", check: checkDataKeyPair, inputs: map[string]property.Value{"keyId": keyId, "keyPairSpec": property.New("ECC_NIST_P256")}},
+		{name: "data key pair unknown spec", check: checkDataKeyPair, inputs: map[string]property.Value{"keyId": keyId, "keyPairSpec": property.New("RSA_1024")}, want: []string{"keyPairSpec"}},
+		{name: "data key pair computed spec", check: checkDataKeyPair, inputs: map[string]property.Value{"keyId": keyId, "keyPairSpec": property.New(property.Computed)}},
+		{name: "re-encrypted blob", check: checkReEncryptedBlob, inputs: map[string]property.Value{"sourceCiphertextBlob": property.New("AQID"), "destinationKeyId": keyId}},
+		{name: "re-encrypted blob not base64", check: checkReEncryptedBlob, inputs: map[string]property.Value{"sourceCiphertextBlob": property.New("not base64!"), "destinationKeyId": keyId}, want: []string{"sourceCiphertextBlob"}},
+		{name: "re-encrypted blob empty key id", check: checkReEncryptedBlob, inputs: map[string]property.Value{"sourceCiphertextBlob": property.New("AQID"), "destinationKeyId": property.New("")}, want: []string{"destinationKeyId"}},
+		{name: "re-encrypted blob computed source", check: checkReEncryptedBlob, inputs: map[string]property.Value{"sourceCiphertextBlob": property.New(property.Computed), "destinationKeyId": keyId}},
+		{name: "self-signed cert", check: checkSelfSignedCert, inputs: map[string]property.Value{"keyId": keyId, "allowedUses": list("cert_signing"), "validityPeriodHours": property.New(24.0)}},
+		{name: "self-signed cert without validity", check: checkSelfSignedCert, inputs: map[string]property.Value{"keyId": keyId, "allowedUses": list("cert_signing")}, want: []string{"validityPeriodHours"}},
+		{name: "self-signed cert computed validity", check: checkSelfSignedCert, inputs: map[string]property.Value{"keyId": keyId, "allowedUses": list("cert_signing"), "validityPeriodHours": property.New(property.Computed)}},
+		{name: "self-signed cert unknown use", check: checkSelfSignedCert, inputs: map[string]property.Value{"keyId": keyId, "allowedUses": list("cert_signing", "world_domination"), "validityPeriodHours": property.New(24.0)}, want: []string{"allowedUses[1]"}},
+		{name: "self-signed cert SM2DSA", check: checkSelfSignedCert, inputs: map[string]property.Value{
+			"keyId":               keyId,
+			"allowedUses":         list("cert_signing"),
+			"validityPeriodHours": property.New(24.0),
+			"signingAlgorithm":    property.New("SM2DSA"),
+		}, want: []string{"signingAlgorithm"}},
+		{name: "cert request", check: checkCertRequest, inputs: map[string]property.Value{"keyId": keyId, "ipAddresses": list("10.0.0.1", "::1"), "uris": list("spiffe://example.com/server")}},
+		{name: "cert request invalid sans", check: checkCertRequest, inputs: map[string]property.Value{"keyId": keyId, "ipAddresses": list("10.0.0.256"), "uris": list("example.com")}, want: []string{"ipAddresses[0]", "uris[0]"}},
+		{name: "locally signed cert invalid pem", check: checkLocallySignedCert, inputs: map[string]property.Value{
+			"certRequestPem":      property.New("not a request"),
+			"caCertPem":           property.New("not a certificate"),
+			"caKeyId":             keyId,
+			"allowedUses":         list("server_auth"),
+			"validityPeriodHours": property.New(24.0),
+		}, want: []string{"certRequestPem", "caCertPem"}},
+		{name: "locally signed cert computed pem", check: checkLocallySignedCert, inputs: map[string]property.Value{
+			"certRequestPem":      property.New(property.Computed),
+			"caCertPem":           property.New(property.Computed),
+			"caKeyId":             keyId,
+			"allowedUses":         list("server_auth"),
+			"validityPeriodHours": property.New(24.0),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures, err := tt.check(property.NewMap(tt.inputs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := properties(failures)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got failures %v, want failures on %v", failures, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got failure on %s, want %s", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func checkRandom(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := Random{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkDataKey(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := DataKey{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkDataKeyPair(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := DataKeyPair{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkReEncryptedBlob(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := ReEncryptedBlob{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkSelfSignedCert(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := SelfSignedCert{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkCertRequest(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := CertRequest{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
+
+func checkLocallySignedCert(inputs property.Map) ([]p.CheckFailure, error) {
+	resp, err := LocallySignedCert{}.Check(context.Background(), infer.CheckRequest{NewInputs: inputs})
+	return resp.Failures, err
+}
@@ -0,0 +1,143 @@
+package awskms
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/jcouyang/pulumi-keygen/internal/localkms"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type Config struct {
+	Region      string `pulumi:"region,optional"`
+	Profile     string `pulumi:"profile,optional"`
+	RoleArn     string `pulumi:"roleArn,optional"`
+	ExternalId  string `pulumi:"externalId,optional"`
+	SessionName string `pulumi:"sessionName,optional"`
+	Endpoint    string `pulumi:"endpoint,optional"`
+	MaxAttempts int    `pulumi:"maxAttempts,optional"`
+
+	LocalKeyStore string `pulumi:"localKeyStore,optional"`
+
+	kms     KMS
+	clients *clientFactory
+}
+
+// WithKMS returns a configuration that sends every awskms operation to svc instead of
+// a client built from the provider configuration, e.g. an in-memory fake in tests.
+func WithKMS(svc KMS) *Config {
+	return &Config{kms: svc}
+}
+
+func (c *Config) Annotate(a infer.Annotator) {
+	a.Describe(&c.Region, "The AWS region KMS requests are sent to. Defaults to the region of the AWS SDK default configuration.")
+	a.Describe(&c.Profile, "The shared config profile used to load credentials.")
+	a.Describe(&c.RoleArn, "ARN of an IAM role to assume before calling KMS.")
+	a.Describe(&c.ExternalId, "External ID passed when assuming roleArn.")
+	a.Describe(&c.SessionName, "Session name used when assuming roleArn.")
+	a.SetDefault(&c.SessionName, "pulumi-keygen")
+	a.Describe(&c.Endpoint, "Custom KMS endpoint URL, e.g. for VPC endpoints or local KMS emulators.")
+	a.Describe(&c.MaxAttempts, "Maximum number of attempts for a KMS request, including the first one. Defaults to the AWS SDK default.")
+	a.Describe(&c.LocalKeyStore, "Path of a local key store file, when set awskms runs against a built-in local KMS instead of AWS, for offline development and tests. "+
+		"Master keys are created in the file on first use of a key ID, ciphertext blobs can only be decrypted with the same file.")
+}
+
+func (c *Config) Configure(ctx context.Context) error {
+	c.clients = &clientFactory{}
+	return nil
+}
+
+// KMS is the part of the KMS API used by awskms, implemented by the AWS SDK client, the
+// local key store and test fakes.
+type KMS interface {
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	GenerateRandom(ctx context.Context, params *kms.GenerateRandomInput, optFns ...func(*kms.Options)) (*kms.GenerateRandomOutput, error)
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	GenerateDataKeyWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyWithoutPlaintextOutput, error)
+	GenerateDataKeyPair(ctx context.Context, params *kms.GenerateDataKeyPairInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairOutput, error)
+	GenerateDataKeyPairWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyPairWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairWithoutPlaintextOutput, error)
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+	ReEncrypt(ctx context.Context, params *kms.ReEncryptInput, optFns ...func(*kms.Options)) (*kms.ReEncryptOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+	Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error)
+	GenerateMac(ctx context.Context, params *kms.GenerateMacInput, optFns ...func(*kms.Options)) (*kms.GenerateMacOutput, error)
+	VerifyMac(ctx context.Context, params *kms.VerifyMacInput, optFns ...func(*kms.Options)) (*kms.VerifyMacOutput, error)
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+}
+
+// clientFactory lazily builds a single KMS client shared by every awskms operation,
+// so stacks that never touch awskms don't need AWS credentials. Only a client that
+// loaded is kept, a failure such as expired credentials is retried on the next call.
+type clientFactory struct {
+	mu  sync.Mutex
+	svc KMS
+}
+
+func (c Config) client(ctx context.Context) (KMS, error) {
+	if c.clients == nil {
+		return c.load(ctx)
+	}
+	c.clients.mu.Lock()
+	defer c.clients.mu.Unlock()
+	if c.clients.svc == nil {
+		svc, err := c.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.clients.svc = svc
+	}
+	return c.clients.svc, nil
+}
+
+func (c Config) load(ctx context.Context) (KMS, error) {
+	if c.kms != nil {
+		return c.kms, nil
+	}
+	if len(c.LocalKeyStore) > 0 {
+		svc, err := localkms.Open(c.LocalKeyStore)
+		if err != nil {
+			return nil, err
+		}
+		return svc, nil
+	}
+	var opts []func(*config.LoadOptions) error
+	if len(c.Region) > 0 {
+		opts = append(opts, config.WithRegion(c.Region))
+	}
+	if len(c.Profile) > 0 {
+		opts = append(opts, config.WithSharedConfigProfile(c.Profile))
+	}
+	if c.MaxAttempts > 0 {
+		opts = append(opts, config.WithRetryMaxAttempts(c.MaxAttempts))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.RoleArn) > 0 {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			if len(c.ExternalId) > 0 {
+				o.ExternalID = aws.String(c.ExternalId)
+			}
+			if len(c.SessionName) > 0 {
+				o.RoleSessionName = c.SessionName
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if len(c.Endpoint) > 0 {
+			o.BaseEndpoint = aws.String(c.Endpoint)
+		}
+	}), nil
+}
+
+func newClient(ctx context.Context) (KMS, error) {
+	return infer.GetConfig[Config](ctx).client(ctx)
+}
@@ -0,0 +1,33 @@
+package awskms
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientRetriesFailedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{LocalKeyStore: path}
+	if err := config.Configure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.client(context.Background()); err == nil {
+		t.Fatal("expected a malformed key store to fail")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	svc, err := config.client(context.Background())
+	if err != nil {
+		t.Fatalf("expected the client to load once the key store is fixed, got %v", err)
+	}
+	if again, err := config.client(context.Background()); err != nil || again != svc {
+		t.Fatal("expected the loaded client to be shared")
+	}
+}
@@ -3,13 +3,14 @@ package awskms
 import (
 	"context"
 	"encoding/base64"
-
-	"time"
+	"fmt"
+	"maps"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
 )
@@ -21,19 +22,18 @@ func (f *DataKeyPair) Annotate(a infer.Annotator) {
 }
 
 type DataKeyPairArgs struct {
-	ValidityPeriodHours int                   `pulumi:"validityPeriodHours,optional"`
-	EarlyRenewalHours   int                   `pulumi:"earlyRenewalHours,optional"`
-	KeyId               string                `pulumi:"keyId"`
-	KeyPairSpec         types.DataKeyPairSpec `pulumi:"keyPairSpec"`
-	WithoutPlainText    bool                  `pulumi:"withoutPlainText,optional"`
+	rotation.Args
+	KeyId             string                `pulumi:"keyId"`
+	KeyPairSpec       types.DataKeyPairSpec `pulumi:"keyPairSpec"`
+	WithoutPlainText  bool                  `pulumi:"withoutPlainText,optional"`
+	EncryptionContext map[string]string     `pulumi:"encryptionContext,optional"`
 }
 
 func (f *DataKeyPairArgs) Annotate(a infer.Annotator) {
-	a.Describe(&f.ValidityPeriodHours, "Number of hours, after initial issuing, that the key will remain valid for.")
-	a.Describe(&f.EarlyRenewalHours, "Number of hours, before expiration, that the key will be renewed.")
 	a.Describe(&f.KeyId, "The ID of the KMS key to use for encrypting the data key.")
 	a.Describe(&f.KeyPairSpec, "The type of data key pair to generate.")
 	a.Describe(&f.WithoutPlainText, "Whether to generate the private key without plaintext. Default is false.")
+	a.Describe(&f.EncryptionContext, "Key-value pairs bound to the private key ciphertext blob, the same context must be provided to decrypt it.")
 }
 
 type DataKeyPairState struct {
@@ -41,24 +41,64 @@ type DataKeyPairState struct {
 	PrivateKeyPlainText      string `pulumi:"privateKey" provider:"secret"`
 	PrivateKeyCiphertextBlob string `pulumi:"privateKeyCiphertextBlob"`
 	PublicKey                string `pulumi:"publicKey"`
-	Created                  int64  `pulumi:"created"`
+	PrivateKeyPem            string `pulumi:"privateKeyPem,optional" provider:"secret"`
+	PublicKeyPem             string `pulumi:"publicKeyPem,optional"`
+	rotation.State
+}
+
+func (f *DataKeyPairState) Annotate(a infer.Annotator) {
+	a.Describe(&f.PrivateKeyPlainText, "The base64 encoded DER PKCS#8 private key, empty when withoutPlainText is set.")
+	a.Describe(&f.PublicKey, "The base64 encoded DER SubjectPublicKeyInfo of the public key.")
+	a.Describe(&f.PrivateKeyPem, "The PEM encoded PKCS#8 private key, e.g. for the privateKeyPem of tls resources. Empty when withoutPlainText is set.")
+	a.Describe(&f.PublicKeyPem, "The PEM encoded public key.")
+}
+
+// setPem sets the PEM encodings of the base64 DER keys.
+func (f *DataKeyPairState) setPem() error {
+	public, err := base64.StdEncoding.DecodeString(f.PublicKey)
+	if err != nil {
+		return fmt.Errorf("publicKey is not base64 encoded")
+	}
+	f.PublicKeyPem, f.PrivateKeyPem = publicKeyPem(public), ""
+	if len(f.PrivateKeyPlainText) > 0 {
+		private, err := base64.StdEncoding.DecodeString(f.PrivateKeyPlainText)
+		if err != nil {
+			return fmt.Errorf("privateKey is not base64 encoded")
+		}
+		f.PrivateKeyPem = privateKeyPem(private)
+	}
+	return nil
+}
+
+func (DataKeyPair) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[DataKeyPairArgs], error) {
+	args, failures, err := infer.DefaultCheck[DataKeyPairArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[DataKeyPairArgs]{}, err
+	}
+	failures = append(failures, rotation.Validate(args.Args, rotation.Now(ctx))...)
+	if check.Known(req.NewInputs, "keyId") {
+		failures = append(failures, check.NotEmpty("keyId", args.KeyId)...)
+	}
+	if check.Known(req.NewInputs, "keyPairSpec") {
+		failures = append(failures, check.Enum("keyPairSpec", args.KeyPairSpec, args.KeyPairSpec.Values())...)
+	}
+	return infer.CheckResponse[DataKeyPairArgs]{Inputs: args, Failures: failures}, nil
 }
 
 func (r DataKeyPair) Create(ctx context.Context, req infer.CreateRequest[DataKeyPairArgs]) (resp infer.CreateResponse[DataKeyPairState], err error) {
 	if req.DryRun {
 		return
 	}
-	cfg, err := config.LoadDefaultConfig(ctx)
+	svc, err := newClient(ctx)
 	if err != nil {
 		return
 	}
 
-	svc := kms.NewFromConfig(cfg)
 	input := &kms.GenerateDataKeyPairInput{
 		KeyId:             aws.String(req.Inputs.KeyId),
 		KeyPairSpec:       req.Inputs.KeyPairSpec,
 		DryRun:            aws.Bool(req.DryRun),
-		EncryptionContext: map[string]string{},
+		EncryptionContext: req.Inputs.EncryptionContext,
 	}
 	if req.Inputs.WithoutPlainText {
 		rresp, err := svc.GenerateDataKeyPairWithoutPlaintext(ctx, &kms.GenerateDataKeyPairWithoutPlaintextInput{
@@ -71,14 +111,16 @@ func (r DataKeyPair) Create(ctx context.Context, req infer.CreateRequest[DataKey
 			return resp, err
 		}
 
-		return infer.CreateResponse[DataKeyPairState]{
-			ID: req.Name, Output: DataKeyPairState{
-				PrivateKeyCiphertextBlob: base64.StdEncoding.EncodeToString(rresp.PrivateKeyCiphertextBlob),
-				DataKeyPairArgs:          req.Inputs,
-				PublicKey:                base64.StdEncoding.EncodeToString(rresp.PublicKey),
-				Created:                  time.Now().Unix(),
-			},
-		}, nil
+		state := DataKeyPairState{
+			PrivateKeyCiphertextBlob: base64.StdEncoding.EncodeToString(rresp.PrivateKeyCiphertextBlob),
+			DataKeyPairArgs:          req.Inputs,
+			PublicKey:                base64.StdEncoding.EncodeToString(rresp.PublicKey),
+			State:                    rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+		}
+		if err := state.setPem(); err != nil {
+			return resp, err
+		}
+		return infer.CreateResponse[DataKeyPairState]{ID: req.Name, Output: state}, nil
 	}
 
 	rresp, err := svc.GenerateDataKeyPair(ctx, input)
@@ -86,14 +128,55 @@ func (r DataKeyPair) Create(ctx context.Context, req infer.CreateRequest[DataKey
 		return
 	}
 
-	return infer.CreateResponse[DataKeyPairState]{
-		ID: req.Name, Output: DataKeyPairState{
-			req.Inputs,
-			base64.StdEncoding.EncodeToString(rresp.PrivateKeyPlaintext),
-			base64.StdEncoding.EncodeToString(rresp.PrivateKeyCiphertextBlob),
-			base64.StdEncoding.EncodeToString(rresp.PublicKey),
-			time.Now().Unix(),
-		},
+	state := DataKeyPairState{
+		DataKeyPairArgs:          req.Inputs,
+		PrivateKeyPlainText:      base64.StdEncoding.EncodeToString(rresp.PrivateKeyPlaintext),
+		PrivateKeyCiphertextBlob: base64.StdEncoding.EncodeToString(rresp.PrivateKeyCiphertextBlob),
+		PublicKey:                base64.StdEncoding.EncodeToString(rresp.PublicKey),
+		State:                    rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+	}
+	if err = state.setPem(); err != nil {
+		return
+	}
+	return infer.CreateResponse[DataKeyPairState]{ID: req.Name, Output: state}, nil
+}
+
+func (DataKeyPair) Read(ctx context.Context, req infer.ReadRequest[DataKeyPairArgs, DataKeyPairState]) (resp infer.ReadResponse[DataKeyPairArgs, DataKeyPairState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.KeyId); err != nil {
+		return
+	}
+	blob, err := base64.StdEncoding.DecodeString(req.State.PrivateKeyCiphertextBlob)
+	if err != nil {
+		return resp, fmt.Errorf("privateKeyCiphertextBlob of %s is not base64 encoded", req.ID)
+	}
+	out, err := svc.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(req.State.KeyId),
+		CiphertextBlob:    blob,
+		EncryptionContext: req.State.EncryptionContext,
+	})
+	if err != nil {
+		return resp, fmt.Errorf("privateKeyCiphertextBlob of %s can no longer be decrypted: %w", req.ID, err)
+	}
+
+	state := req.State
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	if !state.WithoutPlainText {
+		if plaintext := base64.StdEncoding.EncodeToString(out.Plaintext); plaintext != state.PrivateKeyPlainText {
+			p.GetLogger(ctx).Warningf("private key of data key pair %s does not match its ciphertext blob", req.ID)
+			state.PrivateKeyPlainText = plaintext
+		}
+	}
+	if err = state.setPem(); err != nil {
+		return
+	}
+	return infer.ReadResponse[DataKeyPairArgs, DataKeyPairState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
 	}, nil
 }
 
@@ -105,38 +188,27 @@ func (DataKeyPair) Update(ctx context.Context, req infer.UpdateRequest[DataKeyPa
 	if req.DryRun {
 		return infer.UpdateResponse[DataKeyPairState]{}, nil
 	}
-	return infer.UpdateResponse[DataKeyPairState]{
-		Output: DataKeyPairState{
-			req.Inputs,
-			req.State.PrivateKeyPlainText,
-			req.State.PrivateKeyCiphertextBlob,
-			req.State.PublicKey,
-			req.State.Created,
-		},
-	}, nil
+	state := req.State
+	state.DataKeyPairArgs = req.Inputs
+	state.State = rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx))
+	if err := state.setPem(); err != nil {
+		return infer.UpdateResponse[DataKeyPairState]{}, err
+	}
+	return infer.UpdateResponse[DataKeyPairState]{Output: state}, nil
 }
 
 func (DataKeyPair) Diff(ctx context.Context, req infer.DiffRequest[DataKeyPairArgs, DataKeyPairState]) (infer.DiffResponse, error) {
 	diff := map[string]p.PropertyDiff{}
-	if req.Inputs.EarlyRenewalHours != req.State.EarlyRenewalHours {
-		diff["earlyRenewalHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-	if req.Inputs.ValidityPeriodHours != req.State.ValidityPeriodHours {
-		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-
 	if req.Inputs.KeyPairSpec != req.State.KeyPairSpec {
 		diff["keyPairSpec"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
 	if req.Inputs.KeyId != req.State.KeyId {
 		diff["keyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
-	if req.Inputs.ValidityPeriodHours != 0 &&
-		time.Now().Unix() >=
-			req.State.Created+int64(req.Inputs.ValidityPeriodHours-req.Inputs.EarlyRenewalHours)*60*60 {
-		diff["expired"] = p.PropertyDiff{Kind: p.UpdateReplace}
-		p.GetLogger(ctx).Warningf("key %s is about to expire, will be replaced if perform this update!", req.ID)
+	if !maps.Equal(req.Inputs.EncryptionContext, req.State.EncryptionContext) {
+		diff["encryptionContext"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
+	rotation.Diff(ctx, req.ID, req.Inputs.Args, req.State.Args, req.State.State, diff)
 	return infer.DiffResponse{
 		DeleteBeforeReplace: false,
 		HasChanges:          len(diff) > 0,
@@ -149,4 +221,23 @@ func (DataKeyPair) WireDependencies(f infer.FieldSelector, args *DataKeyPairArgs
 	f.OutputField(&state.PrivateKeyCiphertextBlob).DependsOn(f.InputField(&args.KeyPairSpec))
 	f.OutputField(&state.PrivateKeyPlainText).DependsOn(f.InputField(&args.KeyId))
 	f.OutputField(&state.PrivateKeyPlainText).DependsOn(f.InputField(&args.KeyPairSpec))
+	f.OutputField(&state.PrivateKeyCiphertextBlob).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PrivateKeyPlainText).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PublicKey).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PrivateKeyPem).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PublicKeyPem).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PrivateKeyCiphertextBlob).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.PrivateKeyPlainText).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.PublicKey).DependsOn(f.InputField(&args.KeyId))
+	f.OutputField(&state.PublicKey).DependsOn(f.InputField(&args.KeyPairSpec))
+	f.OutputField(&state.PublicKey).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+	f.OutputField(&state.PrivateKeyPem).DependsOn(f.InputField(&args.KeyId))
+	f.OutputField(&state.PrivateKeyPem).DependsOn(f.InputField(&args.KeyPairSpec))
+	f.OutputField(&state.PrivateKeyPem).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.PublicKeyPem).DependsOn(f.InputField(&args.KeyId))
+	f.OutputField(&state.PublicKeyPem).DependsOn(f.InputField(&args.KeyPairSpec))
+	f.OutputField(&state.PublicKeyPem).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.PrivateKeyPlainText).AlwaysSecret()
+	f.OutputField(&state.PrivateKeyPem).AlwaysSecret()
 }
@@ -0,0 +1,95 @@
+package awskms
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestDataKeyPairLifecycle(t *testing.T) {
+	server, fake := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKeyPair")
+
+	inputs := map[string]property.Value{
+		"keyId":       property.New("alias/app"),
+		"keyPairSpec": property.New("ECC_NIST_P256"),
+	}
+	state := r.create(inputs)
+	der, err := base64.StdEncoding.DecodeString(str(t, state, "privateKey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = base64.StdEncoding.DecodeString(str(t, state, "publicKey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !private.(*ecdsa.PrivateKey).PublicKey.Equal(public) {
+		t.Fatal("expected publicKey to belong to privateKey")
+	}
+	str(t, state, "privateKeyCiphertextBlob")
+	if block, _ := pem.Decode([]byte(str(t, state, "privateKeyPem"))); block == nil || block.Type != "PRIVATE KEY" || base64.StdEncoding.EncodeToString(block.Bytes) != str(t, state, "privateKey") {
+		t.Fatal("expected privateKeyPem to be the PKCS#8 PEM of privateKey")
+	}
+	if block, _ := pem.Decode([]byte(str(t, state, "publicKeyPem"))); block == nil || block.Type != "PUBLIC KEY" || base64.StdEncoding.EncodeToString(block.Bytes) != str(t, state, "publicKey") {
+		t.Fatal("expected publicKeyPem to be the PEM of publicKey")
+	}
+
+	if diff := r.diff(inputs); diff.HasChanges {
+		t.Fatalf("expected no changes, got %v", diff.DetailedDiff)
+	}
+	rsa := map[string]property.Value{
+		"keyId":       property.New("alias/app"),
+		"keyPairSpec": property.New("RSA_2048"),
+	}
+	if got := diffKinds(r.diff(rsa)); got["keyPairSpec"] != p.UpdateReplace {
+		t.Fatalf("expected keyPairSpec to replace, got %v", got)
+	}
+	preview := r.preview(rsa)
+	for _, key := range []string{"privateKey", "privateKeyPem", "publicKey", "publicKeyPem"} {
+		if !preview.Get(key).IsComputed() {
+			t.Errorf("expected %s to be unknown in the preview of a new keyPairSpec, got %v", key, preview.Get(key))
+		}
+	}
+
+	if _, err := r.read(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	fake.SetKeyState("alias/app", types.KeyStatePendingDeletion)
+	if _, err := r.read(); err == nil {
+		t.Fatal("expected read of a key pending deletion to fail")
+	}
+	r.delete()
+}
+
+func TestDataKeyPairWithoutPlainText(t *testing.T) {
+	server, _ := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKeyPair")
+	state := r.create(map[string]property.Value{
+		"keyId":            property.New("alias/app"),
+		"keyPairSpec":      property.New("RSA_2048"),
+		"withoutPlainText": property.New(true),
+	})
+	if private := state.Get("privateKey"); !private.IsNull() && private.AsString() != "" {
+		t.Fatal("expected no private key")
+	}
+	if private := state.Get("privateKeyPem"); !private.IsNull() && private.AsString() != "" {
+		t.Fatal("expected no private key PEM")
+	}
+	str(t, state, "privateKeyCiphertextBlob")
+	str(t, state, "publicKey")
+	str(t, state, "publicKeyPem")
+}
@@ -3,13 +3,14 @@ package awskms
 import (
 	"context"
 	"encoding/base64"
-
-	"time"
+	"fmt"
+	"maps"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
 )
@@ -21,78 +22,157 @@ func (f *DataKey) Annotate(a infer.Annotator) {
 }
 
 type DataKeyArgs struct {
-	ValidityPeriodHours int               `pulumi:"validityPeriodHours,optional"`
-	EarlyRenewalHours   int               `pulumi:"earlyRenewalHours,optional"`
-	KeyId               string            `pulumi:"keyId"`
-	KeySpec             types.DataKeySpec `pulumi:"keySpec"`
-	NumberOfBytes       int               `pulumi:"numberOfBytes,optional"`
-	WithoutPlainText    bool              `pulumi:"withoutPlainText,optional"`
+	rotation.Args
+	KeyId             string            `pulumi:"keyId"`
+	KeySpec           types.DataKeySpec `pulumi:"keySpec,optional"`
+	NumberOfBytes     int               `pulumi:"numberOfBytes,optional"`
+	WithoutPlainText  bool              `pulumi:"withoutPlainText,optional"`
+	EncryptionContext map[string]string `pulumi:"encryptionContext,optional"`
+	Retain            int               `pulumi:"retainPreviousVersions,optional"`
 }
 
 func (f *DataKeyArgs) Annotate(a infer.Annotator) {
-	a.Describe(&f.ValidityPeriodHours, "Number of hours, after initial issuing, that the key will remain valid for.")
-	a.Describe(&f.EarlyRenewalHours, "Number of hours, before expiration, that the key will be renewed.")
 	a.Describe(&f.KeyId, "The ID of the KMS key to use for encrypting the data key.")
 	a.Describe(&f.KeySpec, "The type of data key to generate. AES_128 | AES_256. You must specify either the KeySpec or the NumberOfBytes parameter (but not both)")
-	a.Deprecate(&f.NumberOfBytes, "Minimum value of 1. Maximum value of 1024.")
+	a.Describe(&f.NumberOfBytes, "The length of the data key in bytes, e.g. 64 for a HMAC key. Minimum value of 1. Maximum value of 1024. You must specify either the KeySpec or the NumberOfBytes parameter (but not both)")
 	a.Describe(&f.WithoutPlainText, "Whether to generate the private key without plaintext. Default is false.")
+	a.Describe(&f.EncryptionContext, "Key-value pairs bound to the ciphertext blob, the same context must be provided to decrypt it.")
+	a.Describe(&f.Retain, "Number of previous data keys to keep in previousVersions, when set the data key is rotated in place instead of replaced. Default is 0.")
 }
 
 type DataKeyState struct {
 	DataKeyArgs
 	PlainText      string `pulumi:"plaintext" provider:"secret"`
 	CiphertextBlob string `pulumi:"ciphertextBlob"`
+	rotation.State
+	PreviousVersions []PreviousDataKey `pulumi:"previousVersions,optional" provider:"secret"`
+}
+
+func (f *DataKeyState) Annotate(a infer.Annotator) {
+	a.Describe(&f.PreviousVersions, "Data keys replaced by rotation, newest first, to decrypt data still encrypted with them.")
+}
+
+type PreviousDataKey struct {
+	PlainText      string `pulumi:"plaintext,optional" provider:"secret"`
+	CiphertextBlob string `pulumi:"ciphertextBlob"`
 	Created        int64  `pulumi:"created"`
 }
 
+func (DataKey) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[DataKeyArgs], error) {
+	args, failures, err := infer.DefaultCheck[DataKeyArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[DataKeyArgs]{}, err
+	}
+	failures = append(failures, rotation.Validate(args.Args, rotation.Now(ctx))...)
+	if check.Known(req.NewInputs, "keyId") {
+		failures = append(failures, check.NotEmpty("keyId", args.KeyId)...)
+	}
+	switch keySpec, numberOfBytes := check.Set(req.NewInputs, "keySpec"), check.Set(req.NewInputs, "numberOfBytes"); {
+	case keySpec && numberOfBytes:
+		failures = append(failures, p.CheckFailure{Property: "numberOfBytes", Reason: "conflicts with keySpec, only one of them can be provided"})
+	case !keySpec && !numberOfBytes:
+		failures = append(failures, p.CheckFailure{Property: "keySpec", Reason: "one of keySpec or numberOfBytes is required"})
+	}
+	if check.Known(req.NewInputs, "keySpec") {
+		failures = append(failures, check.Enum("keySpec", args.KeySpec, args.KeySpec.Values())...)
+	}
+	if check.Known(req.NewInputs, "numberOfBytes") {
+		failures = append(failures, check.Range("numberOfBytes", args.NumberOfBytes, 1, 1024)...)
+	}
+	if args.Retain < 0 {
+		failures = append(failures, p.CheckFailure{Property: "retainPreviousVersions", Reason: "must not be negative"})
+	}
+	return infer.CheckResponse[DataKeyArgs]{Inputs: args, Failures: failures}, nil
+}
+
 func (r DataKey) Create(ctx context.Context, req infer.CreateRequest[DataKeyArgs]) (resp infer.CreateResponse[DataKeyState], err error) {
 	if req.DryRun {
 		return
 	}
-	cfg, err := config.LoadDefaultConfig(ctx)
+	plaintext, blob, err := generateDataKey(ctx, req.Inputs)
+	if err != nil {
+		return
+	}
+	return infer.CreateResponse[DataKeyState]{
+		ID: req.Name, Output: DataKeyState{
+			req.Inputs,
+			plaintext,
+			blob,
+			rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+			nil,
+		},
+	}, nil
+}
+
+// generateDataKey returns the base64 encoded plaintext and ciphertext blob of a new data
+// key, the plaintext is empty when withoutPlainText is set.
+func generateDataKey(ctx context.Context, inputs DataKeyArgs) (plaintext, blob string, err error) {
+	svc, err := newClient(ctx)
 	if err != nil {
 		return
 	}
 
-	svc := kms.NewFromConfig(cfg)
 	input := &kms.GenerateDataKeyInput{
-		KeyId:             aws.String(req.Inputs.KeyId),
-		KeySpec:           req.Inputs.KeySpec,
-		DryRun:            aws.Bool(req.DryRun),
-		EncryptionContext: map[string]string{},
+		KeyId:             aws.String(inputs.KeyId),
+		KeySpec:           inputs.KeySpec,
+		EncryptionContext: inputs.EncryptionContext,
 	}
-	if req.Inputs.WithoutPlainText {
+	if inputs.NumberOfBytes > 0 {
+		input.NumberOfBytes = aws.Int32(int32(inputs.NumberOfBytes))
+	}
+	if inputs.WithoutPlainText {
 		rresp, err := svc.GenerateDataKeyWithoutPlaintext(ctx, &kms.GenerateDataKeyWithoutPlaintextInput{
 			KeyId:             input.KeyId,
 			KeySpec:           input.KeySpec,
-			DryRun:            input.DryRun,
+			NumberOfBytes:     input.NumberOfBytes,
 			EncryptionContext: input.EncryptionContext,
 		})
 		if err != nil {
-			return resp, err
+			return "", "", err
 		}
-
-		return infer.CreateResponse[DataKeyState]{
-			ID: req.Name, Output: DataKeyState{
-				CiphertextBlob: base64.StdEncoding.EncodeToString(rresp.CiphertextBlob),
-				DataKeyArgs:    req.Inputs,
-				Created:        time.Now().Unix(),
-			},
-		}, nil
+		return "", base64.StdEncoding.EncodeToString(rresp.CiphertextBlob), nil
 	}
 
 	rresp, err := svc.GenerateDataKey(ctx, input)
 	if err != nil {
 		return
 	}
+	return base64.StdEncoding.EncodeToString(rresp.Plaintext), base64.StdEncoding.EncodeToString(rresp.CiphertextBlob), nil
+}
+
+func (DataKey) Read(ctx context.Context, req infer.ReadRequest[DataKeyArgs, DataKeyState]) (resp infer.ReadResponse[DataKeyArgs, DataKeyState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.KeyId); err != nil {
+		return
+	}
+	blob, err := base64.StdEncoding.DecodeString(req.State.CiphertextBlob)
+	if err != nil {
+		return resp, fmt.Errorf("ciphertextBlob of %s is not base64 encoded", req.ID)
+	}
+	out, err := svc.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(req.State.KeyId),
+		CiphertextBlob:    blob,
+		EncryptionContext: req.State.EncryptionContext,
+	})
+	if err != nil {
+		return resp, fmt.Errorf("ciphertextBlob of %s can no longer be decrypted: %w", req.ID, err)
+	}
 
-	return infer.CreateResponse[DataKeyState]{
-		ID: req.Name, Output: DataKeyState{
-			req.Inputs,
-			base64.StdEncoding.EncodeToString(rresp.Plaintext),
-			base64.StdEncoding.EncodeToString(rresp.CiphertextBlob),
-			time.Now().Unix(),
-		},
+	state := req.State
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	if !state.WithoutPlainText {
+		if plaintext := base64.StdEncoding.EncodeToString(out.Plaintext); plaintext != state.PlainText {
+			p.GetLogger(ctx).Warningf("plaintext of data key %s does not match its ciphertext blob", req.ID)
+			state.PlainText = plaintext
+		}
+	}
+	return infer.ReadResponse[DataKeyArgs, DataKeyState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
 	}, nil
 }
 
@@ -104,36 +184,42 @@ func (DataKey) Update(ctx context.Context, req infer.UpdateRequest[DataKeyArgs,
 	if req.DryRun {
 		return infer.UpdateResponse[DataKeyState]{}, nil
 	}
-	return infer.UpdateResponse[DataKeyState]{
-		Output: DataKeyState{
-			req.Inputs,
-			req.State.PlainText,
-			req.State.CiphertextBlob,
-			req.State.Created,
-		},
-	}, nil
+	state := req.State
+	state.DataKeyArgs = req.Inputs
+	state.State = rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx))
+	if req.Inputs.Retain > 0 && rotation.Rotate(req.Inputs.Args, req.State.Args, req.State.Created, rotation.Now(ctx)) {
+		plaintext, blob, err := generateDataKey(ctx, req.Inputs)
+		if err != nil {
+			return infer.UpdateResponse[DataKeyState]{}, err
+		}
+		state.PreviousVersions = append([]PreviousDataKey{{state.PlainText, state.CiphertextBlob, state.Created}}, state.PreviousVersions...)
+		state.PlainText, state.CiphertextBlob = plaintext, blob
+		state.State = rotation.New(req.Inputs.Args, rotation.Now(ctx))
+	}
+	state.PreviousVersions = rotation.Retain(state.PreviousVersions, req.Inputs.Retain)
+	return infer.UpdateResponse[DataKeyState]{Output: state}, nil
 }
 
 func (DataKey) Diff(ctx context.Context, req infer.DiffRequest[DataKeyArgs, DataKeyState]) (infer.DiffResponse, error) {
 	diff := map[string]p.PropertyDiff{}
-	if req.Inputs.EarlyRenewalHours != req.State.EarlyRenewalHours {
-		diff["earlyRenewalHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-	if req.Inputs.ValidityPeriodHours != req.State.ValidityPeriodHours {
-		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-
 	if req.Inputs.KeySpec != req.State.KeySpec {
 		diff["keySpec"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
+	if req.Inputs.NumberOfBytes != req.State.NumberOfBytes {
+		diff["numberOfBytes"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
 	if req.Inputs.KeyId != req.State.KeyId {
 		diff["keyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
-	if req.Inputs.ValidityPeriodHours != 0 &&
-		time.Now().Unix() >=
-			req.State.Created+int64(req.Inputs.ValidityPeriodHours-req.Inputs.EarlyRenewalHours)*60*60 {
-		diff["expired"] = p.PropertyDiff{Kind: p.UpdateReplace}
-		p.GetLogger(ctx).Warningf("key %s is about to expire, will be replaced if perform this update!", req.ID)
+	if !maps.Equal(req.Inputs.EncryptionContext, req.State.EncryptionContext) {
+		diff["encryptionContext"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.Retain != req.State.Retain {
+		diff["retainPreviousVersions"] = p.PropertyDiff{Kind: p.Update}
+	}
+	rotation.Diff(ctx, req.ID, req.Inputs.Args, req.State.Args, req.State.State, diff)
+	if req.Inputs.Retain > 0 {
+		rotation.InPlace(diff)
 	}
 	return infer.DiffResponse{
 		DeleteBeforeReplace: false,
@@ -147,4 +233,14 @@ func (DataKey) WireDependencies(f infer.FieldSelector, args *DataKeyArgs, state
 	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.KeySpec))
 	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.KeyId))
 	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.KeySpec))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.NumberOfBytes))
+	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.NumberOfBytes))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.EncryptionContext))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+	f.OutputField(&state.PreviousVersions).DependsOn(f.InputField(&args.Retain))
+	f.OutputField(&state.PlainText).AlwaysSecret()
+	f.OutputField(&state.PreviousVersions).AlwaysSecret()
 }
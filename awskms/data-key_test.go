@@ -0,0 +1,131 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestDataKeyLifecycle(t *testing.T) {
+	server, fake := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKey")
+
+	encryptionContext := property.New(property.NewMap(map[string]property.Value{"stack": property.New("dev")}))
+	inputs := map[string]property.Value{
+		"keyId":             property.New("alias/app"),
+		"keySpec":           property.New("AES_256"),
+		"encryptionContext": encryptionContext,
+	}
+	state := r.create(inputs)
+	plaintext := str(t, state, "plaintext")
+	if b, _ := base64.StdEncoding.DecodeString(plaintext); len(b) != 32 {
+		t.Fatalf("expected a 32 byte data key, got %d bytes", len(b))
+	}
+	blob, err := base64.StdEncoding.DecodeString(str(t, state, "ciphertextBlob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := fake.Decrypt(context.Background(), &kms.DecryptInput{CiphertextBlob: blob, EncryptionContext: map[string]string{"stack": "dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base64.StdEncoding.EncodeToString(out.Plaintext) != plaintext {
+		t.Fatal("ciphertextBlob does not decrypt to the plaintext")
+	}
+
+	if diff := r.diff(inputs); diff.HasChanges {
+		t.Fatalf("expected no changes, got %v", diff.DetailedDiff)
+	}
+	for key, value := range map[string]property.Value{
+		"keyId":             property.New("alias/other"),
+		"keySpec":           property.New("AES_128"),
+		"encryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("prod")})),
+	} {
+		changed := map[string]property.Value{}
+		for k, v := range inputs {
+			changed[k] = v
+		}
+		changed[key] = value
+		if got := diffKinds(r.diff(changed)); got[key] != p.UpdateReplace {
+			t.Fatalf("expected %s to replace, got %v", key, got)
+		}
+		if preview := r.preview(changed); !preview.Get("plaintext").IsComputed() {
+			t.Fatalf("expected plaintext to be unknown in the preview of a new %s", key)
+		}
+	}
+
+	if _, err := r.read(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	fake.SetKeyState("alias/app", types.KeyStateDisabled)
+	if _, err := r.read(); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("expected read of a disabled key to fail, got %v", err)
+	}
+	r.delete()
+}
+
+func TestDataKeyNumberOfBytes(t *testing.T) {
+	server, _ := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKey")
+	state := r.create(map[string]property.Value{
+		"keyId":         property.New("alias/app"),
+		"numberOfBytes": property.New(64.0),
+	})
+	if b, _ := base64.StdEncoding.DecodeString(str(t, state, "plaintext")); len(b) != 64 {
+		t.Fatalf("expected a 64 byte data key, got %d bytes", len(b))
+	}
+	if got := diffKinds(r.diff(map[string]property.Value{
+		"keyId":         property.New("alias/app"),
+		"numberOfBytes": property.New(32.0),
+	})); got["numberOfBytes"] != p.UpdateReplace {
+		t.Fatalf("expected numberOfBytes to replace, got %v", got)
+	}
+}
+
+func TestDataKeyWithoutPlainText(t *testing.T) {
+	server, _ := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKey")
+	state := r.create(map[string]property.Value{
+		"keyId":            property.New("alias/app"),
+		"keySpec":          property.New("AES_256"),
+		"withoutPlainText": property.New(true),
+	})
+	if plaintext := state.Get("plaintext"); !plaintext.IsNull() && plaintext.AsString() != "" {
+		t.Fatal("expected no plaintext")
+	}
+	if str(t, state, "ciphertextBlob") == "" {
+		t.Fatal("expected a ciphertext blob")
+	}
+}
+
+func TestDataKeyRetainPreviousVersions(t *testing.T) {
+	server, _ := newServer(t)
+	r := newResource(t, server, "keygen:awskms:DataKey")
+	inputs := func(version string) map[string]property.Value {
+		return map[string]property.Value{
+			"keyId":                  property.New("alias/app"),
+			"keySpec":                property.New("AES_256"),
+			"retainPreviousVersions": property.New(1.0),
+			"triggers":               property.New(property.NewMap(map[string]property.Value{"version": property.New(version)})),
+		}
+	}
+	first := str(t, r.create(inputs("1")), "plaintext")
+
+	if got := diffKinds(r.diff(inputs("2"))); got["triggers"] != p.Update {
+		t.Fatalf("expected triggers to rotate in place, got %v", got)
+	}
+	state := r.update(inputs("2"))
+	if str(t, state, "plaintext") == first {
+		t.Fatal("expected a new data key")
+	}
+	previous := state.Get("previousVersions")
+	if versions := previous.AsArray(); versions.Len() != 1 || versions.Get(0).AsMap().Get("plaintext").AsString() != first {
+		t.Fatalf("expected the replaced data key to be kept, got %v", previous)
+	}
+}
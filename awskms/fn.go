@@ -3,9 +3,10 @@ package awskms
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 	"github.com/pulumi/pulumi-go-provider/infer"
@@ -19,16 +20,16 @@ func (Encrypt) Invoke(ctx context.Context, req infer.FunctionRequest[EncryptArgs
 		return
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	svc, err := newClient(ctx)
 	if err != nil {
 		return
 	}
 
-	svc := kms.NewFromConfig(cfg)
 	input := &kms.EncryptInput{
 		KeyId:               aws.String(req.Input.KeyId),
 		EncryptionAlgorithm: types.EncryptionAlgorithmSpec(req.Input.EncryptionAlgorithm),
 		Plaintext:           plaintext,
+		EncryptionContext:   req.Input.EncryptionContext,
 	}
 	out, err := svc.Encrypt(ctx, input)
 	if err != nil {
@@ -45,15 +46,17 @@ func (r *Encrypt) Annotate(a infer.Annotator) {
 }
 
 type EncryptArgs struct {
-	KeyId               string `pulumi:"keyId"`
-	EncryptionAlgorithm string `pulumi:"encryptionAlgorithm,optional"`
-	Plaintext           string `pulumi:"plaintext" provider:"secret"`
+	KeyId               string            `pulumi:"keyId"`
+	EncryptionAlgorithm string            `pulumi:"encryptionAlgorithm,optional"`
+	Plaintext           string            `pulumi:"plaintext" provider:"secret"`
+	EncryptionContext   map[string]string `pulumi:"encryptionContext,optional"`
 }
 
 func (er *EncryptArgs) Annotate(a infer.Annotator) {
 	a.Describe(&er.Plaintext, "The plaintext to encrypt. Base64-encoded binary data object")
 	a.Describe(&er.EncryptionAlgorithm, "The encryption algorithm to use. SYMMETRIC_DEFAULT | RSAES_OAEP_SHA_1 | RSAES_OAEP_SHA_256 | SM2PKE")
 	a.Describe(&er.KeyId, "Identifies the KMS key to use in the encryption operation")
+	a.Describe(&er.EncryptionContext, "Key-value pairs bound to the ciphertext, the same context must be provided to decrypt it.")
 }
 
 type EncryptResult struct {
@@ -72,17 +75,21 @@ func (Decrypt) Invoke(ctx context.Context, req infer.FunctionRequest[DecryptArgs
 		return
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	svc, err := newClient(ctx)
 	if err != nil {
 		return
 	}
 
-	svc := kms.NewFromConfig(cfg)
 	input := &kms.DecryptInput{
-		CiphertextBlob: ciphertext,
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: req.Input.EncryptionContext,
 	}
 
 	out, err := svc.Decrypt(ctx, input)
+	var invalid *types.InvalidCiphertextException
+	if errors.As(err, &invalid) {
+		return resp, fmt.Errorf("failed to decrypt ciphertext, check that encryptionContext matches the one used to encrypt it: %w", err)
+	}
 	if err != nil {
 		return
 	}
@@ -92,13 +99,15 @@ func (Decrypt) Invoke(ctx context.Context, req infer.FunctionRequest[DecryptArgs
 }
 
 type DecryptArgs struct {
-	Ciphertext string `pulumi:"ciphertext"`
+	Ciphertext        string            `pulumi:"ciphertext"`
+	EncryptionContext map[string]string `pulumi:"encryptionContext,optional"`
 }
 
 func (r *DecryptArgs) Annotate(a infer.Annotator) {
 	a.Describe(&r.Ciphertext, "The ciphertext to decrypt.")
+	a.Describe(&r.EncryptionContext, "The encryption context that was used to encrypt the ciphertext.")
 }
 
 type DecryptResult struct {
-	Result string `pulumi:"result"`
+	Result string `pulumi:"result" provider:"secret"`
 }
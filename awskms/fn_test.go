@@ -0,0 +1,54 @@
+package awskms
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	server, _ := newServer(t)
+	plaintext := base64.StdEncoding.EncodeToString([]byte("hello"))
+	encryptionContext := property.New(property.NewMap(map[string]property.Value{"stack": property.New("dev")}))
+
+	encrypted, err := server.Invoke(p.InvokeRequest{
+		Token: "keygen:awskms:encrypt",
+		Args: property.NewMap(map[string]property.Value{
+			"keyId":             property.New("alias/app"),
+			"plaintext":         property.New(plaintext),
+			"encryptionContext": encryptionContext,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := str(t, encrypted.Return, "result")
+
+	decrypted, err := server.Invoke(p.InvokeRequest{
+		Token: "keygen:awskms:decrypt",
+		Args: property.NewMap(map[string]property.Value{
+			"ciphertext":        property.New(ciphertext),
+			"encryptionContext": encryptionContext,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := str(t, decrypted.Return, "result"); got != plaintext {
+		t.Fatalf("expected %s, got %s", plaintext, got)
+	}
+
+	_, err = server.Invoke(p.InvokeRequest{
+		Token: "keygen:awskms:decrypt",
+		Args: property.NewMap(map[string]property.Value{
+			"ciphertext":        property.New(ciphertext),
+			"encryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("prod")})),
+		}),
+	})
+	if err == nil || !strings.Contains(err.Error(), "encryptionContext") {
+		t.Fatalf("expected decrypt with another encryptionContext to fail, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package awskms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// checkKeyEnabled fails with a descriptive error when the KMS key can no longer be used,
+// e.g. it was disabled or scheduled for deletion after the data key was generated.
+func checkKeyEnabled(ctx context.Context, svc KMS, keyId string) error {
+	out, err := svc.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyId)})
+	if err != nil {
+		return fmt.Errorf("failed to describe key %s: %w", keyId, err)
+	}
+	switch state := out.KeyMetadata.KeyState; state {
+	case types.KeyStateEnabled:
+		return nil
+	case types.KeyStatePendingDeletion, types.KeyStatePendingReplicaDeletion:
+		if out.KeyMetadata.DeletionDate != nil {
+			return fmt.Errorf("key %s is scheduled for deletion on %s", keyId, out.KeyMetadata.DeletionDate.Format("2006-01-02"))
+		}
+		return fmt.Errorf("key %s is scheduled for deletion", keyId)
+	default:
+		return fmt.Errorf("key %s is not enabled, current state is %s", keyId, state)
+	}
+}
@@ -0,0 +1,180 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type LocallySignedCert struct{}
+
+func (f *LocallySignedCert) Annotate(a infer.Annotator) {
+	a.Describe(&f, "An X.509 certificate issued to a certificate signing request by a certificate authority whose private key never leaves KMS")
+}
+
+type LocallySignedCertArgs struct {
+	rotation.Args
+	CertOptions
+	CertRequestPem string `pulumi:"certRequestPem"`
+	CaCertPem      string `pulumi:"caCertPem"`
+	CaKeyId        string `pulumi:"caKeyId"`
+}
+
+func (f *LocallySignedCertArgs) Annotate(a infer.Annotator) {
+	a.Describe(&f.CertRequestPem, "The PEM encoded certificate signing request to issue the certificate to, e.g. from a CertRequest or tls.CertRequest. Its subject and subject alternative names are copied to the certificate.")
+	a.Describe(&f.CaCertPem, "The PEM encoded certificate of the certificate authority, e.g. from a SelfSignedCert.")
+	a.Describe(&f.CaKeyId, "The asymmetric KMS key of the certificate authority, it must hold the private key of caCertPem.")
+}
+
+type LocallySignedCertState struct {
+	LocallySignedCertArgs
+	CertPem string `pulumi:"certPem"`
+	rotation.State
+}
+
+func (f *LocallySignedCertState) Annotate(a infer.Annotator) {
+	a.Describe(&f.CertPem, "The PEM encoded certificate, valid from created until expiresAt.")
+}
+
+func (LocallySignedCert) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[LocallySignedCertArgs], error) {
+	args, failures, err := infer.DefaultCheck[LocallySignedCertArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[LocallySignedCertArgs]{}, err
+	}
+	if check.Known(req.NewInputs, "certRequestPem") {
+		if _, err := parseCertRequestPem(args.CertRequestPem); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "certRequestPem", Reason: err.Error()})
+		}
+	}
+	if check.Known(req.NewInputs, "caCertPem") {
+		if ca, err := parseCertPem(args.CaCertPem); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "caCertPem", Reason: err.Error()})
+		} else if !ca.IsCA {
+			failures = append(failures, p.CheckFailure{Property: "caCertPem", Reason: "is not a certificate authority, set isCaCertificate when issuing it"})
+		}
+	}
+	if check.Known(req.NewInputs, "caKeyId") {
+		failures = append(failures, check.NotEmpty("caKeyId", args.CaKeyId)...)
+	}
+	failures = append(failures, args.CertOptions.validate(ctx, req.NewInputs, args.Args)...)
+	return infer.CheckResponse[LocallySignedCertArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (LocallySignedCert) Create(ctx context.Context, req infer.CreateRequest[LocallySignedCertArgs]) (resp infer.CreateResponse[LocallySignedCertState], err error) {
+	if req.DryRun {
+		return
+	}
+	csr, err := parseCertRequestPem(req.Inputs.CertRequestPem)
+	if err != nil {
+		return resp, fmt.Errorf("certRequestPem %s", err)
+	}
+	ca, err := parseCertPem(req.Inputs.CaCertPem)
+	if err != nil {
+		return resp, fmt.Errorf("caCertPem %s", err)
+	}
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	s, err := newSigner(ctx, svc, req.Inputs.CaKeyId, req.Inputs.SigningAlgorithm)
+	if err != nil {
+		return
+	}
+	if public, ok := s.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !public.Equal(ca.PublicKey) {
+		return resp, fmt.Errorf("caKeyId %s does not hold the private key of caCertPem", req.Inputs.CaKeyId)
+	}
+
+	state := LocallySignedCertState{
+		LocallySignedCertArgs: req.Inputs,
+		State:                 rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+	}
+	template, err := req.Inputs.CertOptions.template(state.State)
+	if err != nil {
+		return
+	}
+	template.Subject = csr.Subject
+	template.DNSNames = csr.DNSNames
+	template.IPAddresses = csr.IPAddresses
+	template.URIs = csr.URIs
+	template.EmailAddresses = csr.EmailAddresses
+	template.SignatureAlgorithm = s.signatureAlgorithm()
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, csr.PublicKey, s)
+	if err != nil {
+		return resp, fmt.Errorf("failed to sign certificate with %s: %w", req.Inputs.CaKeyId, err)
+	}
+	state.CertPem = certPem(der)
+	return infer.CreateResponse[LocallySignedCertState]{ID: req.Name, Output: state}, nil
+}
+
+func (LocallySignedCert) Read(ctx context.Context, req infer.ReadRequest[LocallySignedCertArgs, LocallySignedCertState]) (resp infer.ReadResponse[LocallySignedCertArgs, LocallySignedCertState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.CaKeyId); err != nil {
+		return
+	}
+	if _, err = parseCertPem(req.State.CertPem); err != nil {
+		return resp, fmt.Errorf("certPem of %s %s", req.ID, err)
+	}
+	state := req.State
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	return infer.ReadResponse[LocallySignedCertArgs, LocallySignedCertState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
+	}, nil
+}
+
+func (LocallySignedCert) Delete(ctx context.Context, req infer.DeleteRequest[LocallySignedCertState]) (infer.DeleteResponse, error) {
+	return infer.DeleteResponse{}, nil
+}
+
+func (LocallySignedCert) Update(ctx context.Context, req infer.UpdateRequest[LocallySignedCertArgs, LocallySignedCertState]) (infer.UpdateResponse[LocallySignedCertState], error) {
+	if req.DryRun {
+		return infer.UpdateResponse[LocallySignedCertState]{}, nil
+	}
+	state := req.State
+	state.LocallySignedCertArgs = req.Inputs
+	state.State = rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx))
+	return infer.UpdateResponse[LocallySignedCertState]{Output: state}, nil
+}
+
+func (LocallySignedCert) Diff(ctx context.Context, req infer.DiffRequest[LocallySignedCertArgs, LocallySignedCertState]) (infer.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+	if req.Inputs.CertRequestPem != req.State.CertRequestPem {
+		diff["certRequestPem"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.CaCertPem != req.State.CaCertPem {
+		diff["caCertPem"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.CaKeyId != req.State.CaKeyId {
+		diff["caKeyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	req.Inputs.CertOptions.diff(ctx, req.ID, req.State.CertOptions, req.Inputs.Args, req.State.Args, req.State.State, diff)
+	return infer.DiffResponse{
+		DeleteBeforeReplace: false,
+		HasChanges:          len(diff) > 0,
+		DetailedDiff:        diff,
+	}, nil
+}
+
+func (LocallySignedCert) WireDependencies(f infer.FieldSelector, args *LocallySignedCertArgs, state *LocallySignedCertState) {
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.CertRequestPem))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.CaCertPem))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.CaKeyId))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.AllowedUses))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.IsCaCertificate))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.SigningAlgorithm))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.ValidityPeriodHours))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+}
@@ -0,0 +1,140 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type GenerateMac struct{}
+
+func (g *GenerateMac) Annotate(a infer.Annotator) {
+	a.Describe(g, "GenerateMac computes the HMAC of a message with a KMS HMAC key, the key never leaves KMS.")
+}
+
+func (GenerateMac) Invoke(ctx context.Context, req infer.FunctionRequest[GenerateMacArgs]) (resp infer.FunctionResponse[GenerateMacResult], err error) {
+	message, err := decodeMessage("macAlgorithm", req.Input.MacAlgorithm, req.Input.Message, req.Input.MessageEncoding, true)
+	if err != nil {
+		return
+	}
+
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	out, err := svc.GenerateMac(ctx, &kms.GenerateMacInput{
+		KeyId:        aws.String(req.Input.KeyId),
+		Message:      message,
+		MacAlgorithm: req.Input.MacAlgorithm,
+		GrantTokens:  req.Input.GrantTokens,
+	})
+	if err != nil {
+		return
+	}
+
+	return infer.FunctionResponse[GenerateMacResult]{
+		Output: GenerateMacResult{
+			Mac:   base64.StdEncoding.EncodeToString(out.Mac),
+			KeyId: aws.ToString(out.KeyId),
+		},
+	}, nil
+}
+
+type GenerateMacArgs struct {
+	KeyId           string                 `pulumi:"keyId"`
+	Message         string                 `pulumi:"message" provider:"secret"`
+	MessageEncoding string                 `pulumi:"messageEncoding,optional"`
+	MacAlgorithm    types.MacAlgorithmSpec `pulumi:"macAlgorithm"`
+	GrantTokens     []string               `pulumi:"grantTokens,optional"`
+}
+
+func (g *GenerateMacArgs) Annotate(a infer.Annotator) {
+	a.Describe(&g.KeyId, "Identifies the HMAC KMS key to use, its key usage must be GENERATE_VERIFY_MAC.")
+	a.Describe(&g.Message, "The message to compute the HMAC of, at most 4096 bytes.")
+	a.Describe(&g.MessageEncoding, "How message is encoded, use base64 or hex for binary data. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&g.MacAlgorithm, "The MAC algorithm, it must be supported by the key spec of the KMS key. HMAC_SHA_224 | HMAC_SHA_256 | HMAC_SHA_384 | HMAC_SHA_512")
+	a.Describe(&g.GrantTokens, "Grant tokens for a grant that is not yet eventually consistent.")
+}
+
+type GenerateMacResult struct {
+	Mac   string `pulumi:"mac" provider:"secret"`
+	KeyId string `pulumi:"keyId"`
+}
+
+func (g *GenerateMacResult) Annotate(a infer.Annotator) {
+	a.Describe(&g.Mac, "The base64 encoded HMAC, secret since it is often used as a derived secret such as a webhook secret.")
+	a.Describe(&g.KeyId, "The ARN of the HMAC KMS key.")
+}
+
+type VerifyMac struct{}
+
+func (v *VerifyMac) Annotate(a infer.Annotator) {
+	a.Describe(v, "VerifyMac verifies the HMAC of a message with a KMS HMAC key, the comparison is done in constant time by KMS.")
+}
+
+func (VerifyMac) Invoke(ctx context.Context, req infer.FunctionRequest[VerifyMacArgs]) (resp infer.FunctionResponse[VerifyMacResult], err error) {
+	message, err := decodeMessage("macAlgorithm", req.Input.MacAlgorithm, req.Input.Message, req.Input.MessageEncoding, true)
+	if err != nil {
+		return
+	}
+	mac, err := base64.StdEncoding.DecodeString(req.Input.Mac)
+	if err != nil {
+		return resp, fmt.Errorf("mac is not base64 encoded")
+	}
+
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	out, err := svc.VerifyMac(ctx, &kms.VerifyMacInput{
+		KeyId:        aws.String(req.Input.KeyId),
+		Message:      message,
+		Mac:          mac,
+		MacAlgorithm: req.Input.MacAlgorithm,
+		GrantTokens:  req.Input.GrantTokens,
+	})
+	var invalid *types.KMSInvalidMacException
+	if errors.As(err, &invalid) {
+		return infer.FunctionResponse[VerifyMacResult]{Output: VerifyMacResult{Valid: false}}, nil
+	}
+	if err != nil {
+		return
+	}
+	return infer.FunctionResponse[VerifyMacResult]{
+		Output: VerifyMacResult{Valid: out.MacValid},
+	}, nil
+}
+
+type VerifyMacArgs struct {
+	KeyId           string                 `pulumi:"keyId"`
+	Message         string                 `pulumi:"message" provider:"secret"`
+	MessageEncoding string                 `pulumi:"messageEncoding,optional"`
+	Mac             string                 `pulumi:"mac" provider:"secret"`
+	MacAlgorithm    types.MacAlgorithmSpec `pulumi:"macAlgorithm"`
+	GrantTokens     []string               `pulumi:"grantTokens,optional"`
+}
+
+func (v *VerifyMacArgs) Annotate(a infer.Annotator) {
+	a.Describe(&v.KeyId, "Identifies the HMAC KMS key that made the mac.")
+	a.Describe(&v.Message, "The message the mac was computed for, at most 4096 bytes.")
+	a.Describe(&v.MessageEncoding, "How message is encoded, use base64 or hex for binary data. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&v.Mac, "The base64 encoded HMAC to verify.")
+	a.Describe(&v.MacAlgorithm, "The MAC algorithm the mac was computed with.")
+	a.Describe(&v.GrantTokens, "Grant tokens for a grant that is not yet eventually consistent.")
+}
+
+type VerifyMacResult struct {
+	Valid bool `pulumi:"valid"`
+}
+
+func (v *VerifyMacResult) Annotate(a infer.Annotator) {
+	a.Describe(&v.Valid, "Whether the mac is valid for the message and key.")
+}
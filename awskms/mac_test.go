@@ -0,0 +1,60 @@
+package awskms
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestGenerateVerifyMac(t *testing.T) {
+	server, _ := newServer(t)
+	message := property.New(hex.EncodeToString([]byte("webhook payload")))
+	out, err := invoke(t, server, "keygen:awskms:generateMac", map[string]property.Value{
+		"keyId":           property.New("alias/hmac"),
+		"message":         message,
+		"messageEncoding": property.New("hex"),
+		"macAlgorithm":    property.New("HMAC_SHA_256"),
+		"grantTokens":     property.New([]property.Value{property.New("token")}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Get("mac").Secret() {
+		t.Fatal("expected mac to be secret")
+	}
+	mac := out.Get("mac")
+
+	for _, tt := range []struct {
+		name    string
+		message property.Value
+		valid   bool
+	}{
+		{name: "same message", message: message, valid: true},
+		{name: "tampered message", message: property.New(hex.EncodeToString([]byte("tampered payload"))), valid: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := invoke(t, server, "keygen:awskms:verifyMac", map[string]property.Value{
+				"keyId":           property.New("alias/hmac"),
+				"message":         tt.message,
+				"messageEncoding": property.New("hex"),
+				"mac":             mac,
+				"macAlgorithm":    property.New("HMAC_SHA_256"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.Get("valid").AsBool(); got != tt.valid {
+				t.Fatalf("got valid %v, want %v", got, tt.valid)
+			}
+		})
+	}
+
+	if _, err := invoke(t, server, "keygen:awskms:generateMac", map[string]property.Value{
+		"keyId":        property.New("alias/hmac"),
+		"message":      property.New("webhook payload"),
+		"macAlgorithm": property.New("HMAC_MD5"),
+	}); err == nil {
+		t.Fatal("expected an unknown macAlgorithm to fail")
+	}
+}
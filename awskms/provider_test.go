@@ -0,0 +1,150 @@
+package awskms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/jcouyang/pulumi-keygen/internal/kmstest"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi-go-provider/integration"
+	presource "github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+// newServer serves the awskms resources and functions against an in-memory KMS.
+func newServer(t *testing.T) (integration.Server, *kmstest.KMS) {
+	t.Helper()
+	return newServerContext(t, context.Background())
+}
+
+// newServerContext is newServer with every request made in ctx, e.g. with a rotation clock.
+func newServerContext(t *testing.T, ctx context.Context) (integration.Server, *kmstest.KMS) {
+	t.Helper()
+	fake := kmstest.New()
+	provider, err := infer.NewProviderBuilder().
+		WithResources(infer.Resource(Random{}), infer.Resource(DataKey{}), infer.Resource(DataKeyPair{}), infer.Resource(ReEncryptedBlob{}), infer.Resource(SelfSignedCert{}), infer.Resource(CertRequest{}), infer.Resource(LocallySignedCert{})).
+		WithFunctions(infer.Function(Encrypt{}), infer.Function(Decrypt{}), infer.Function(Sign{}), infer.Function(Verify{}), infer.Function(GenerateMac{}), infer.Function(VerifyMac{}), infer.Function(ReEncrypt{}), infer.Function(GetPublicKey{})).
+		WithConfig(infer.Config(WithKMS(fake))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := integration.NewServer(ctx, "keygen", semver.MustParse("0.1.0"), integration.WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Configure(p.ConfigureRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	return server, fake
+}
+
+// resource drives a single resource through the provider lifecycle.
+type resource struct {
+	t      *testing.T
+	server integration.Server
+	urn    presource.URN
+	id     string
+	state  property.Map
+}
+
+func newResource(t *testing.T, server integration.Server, token string) *resource {
+	return &resource{t: t, server: server, urn: presource.NewURN("test", "awskms", "", tokens.Type(token), t.Name())}
+}
+
+func (r *resource) check(inputs map[string]property.Value) property.Map {
+	r.t.Helper()
+	resp, err := r.server.Check(p.CheckRequest{Urn: r.urn, State: r.state, Inputs: property.NewMap(inputs)})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if len(resp.Failures) > 0 {
+		r.t.Fatalf("unexpected check failures %v", resp.Failures)
+	}
+	return resp.Inputs
+}
+
+func (r *resource) create(inputs map[string]property.Value) property.Map {
+	r.t.Helper()
+	checked := r.check(inputs)
+	if _, err := r.server.Create(p.CreateRequest{Urn: r.urn, Properties: checked, DryRun: true}); err != nil {
+		r.t.Fatalf("preview: %s", err)
+	}
+	resp, err := r.server.Create(p.CreateRequest{Urn: r.urn, Properties: checked})
+	if err != nil {
+		r.t.Fatalf("create: %s", err)
+	}
+	r.id, r.state = resp.ID, resp.Properties
+	return r.state
+}
+
+func (r *resource) diff(inputs map[string]property.Value) p.DiffResponse {
+	r.t.Helper()
+	resp, err := r.server.Diff(p.DiffRequest{ID: r.id, Urn: r.urn, State: r.state, Inputs: r.check(inputs)})
+	if err != nil {
+		r.t.Fatalf("diff: %s", err)
+	}
+	return resp
+}
+
+func (r *resource) update(inputs map[string]property.Value) property.Map {
+	r.t.Helper()
+	checked := r.check(inputs)
+	resp, err := r.server.Update(p.UpdateRequest{ID: r.id, Urn: r.urn, State: r.state, Inputs: checked})
+	if err != nil {
+		r.t.Fatalf("update: %s", err)
+	}
+	r.state = resp.Properties
+	return r.state
+}
+
+// preview returns the outputs a dry run update with inputs would report.
+func (r *resource) preview(inputs map[string]property.Value) property.Map {
+	r.t.Helper()
+	resp, err := r.server.Update(p.UpdateRequest{ID: r.id, Urn: r.urn, State: r.state, Inputs: r.check(inputs), DryRun: true})
+	if err != nil {
+		r.t.Fatalf("preview: %s", err)
+	}
+	return resp.Properties
+}
+
+func (r *resource) read() (property.Map, error) {
+	r.t.Helper()
+	resp, err := r.server.Read(p.ReadRequest{ID: r.id, Urn: r.urn, Properties: r.state})
+	return resp.Properties, err
+}
+
+func (r *resource) delete() {
+	r.t.Helper()
+	if err := r.server.Delete(p.DeleteRequest{ID: r.id, Urn: r.urn, Properties: r.state}); err != nil {
+		r.t.Fatalf("delete: %s", err)
+	}
+}
+
+// invoke calls the function token with args.
+func invoke(t *testing.T, server integration.Server, token string, args map[string]property.Value) (property.Map, error) {
+	t.Helper()
+	resp, err := server.Invoke(p.InvokeRequest{Token: tokens.Type(token), Args: property.NewMap(args)})
+	return resp.Return, err
+}
+
+// str returns the string output key, failing when it is not set.
+func str(t *testing.T, outputs property.Map, key string) string {
+	t.Helper()
+	v := outputs.Get(key)
+	if !v.IsString() || v.AsString() == "" {
+		t.Fatalf("expected %s to be set, got %v", key, v)
+	}
+	return v.AsString()
+}
+
+func diffKinds(resp p.DiffResponse) map[string]p.DiffKind {
+	kinds := map[string]p.DiffKind{}
+	for k, d := range resp.DetailedDiff {
+		kinds[k] = d.Kind
+	}
+	return kinds
+}
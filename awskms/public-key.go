@@ -0,0 +1,87 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type GetPublicKey struct{}
+
+func (g *GetPublicKey) Annotate(a infer.Annotator) {
+	a.Describe(g, "GetPublicKey returns the public key of an asymmetric KMS key, whose private key never leaves KMS.")
+}
+
+func (GetPublicKey) Invoke(ctx context.Context, req infer.FunctionRequest[GetPublicKeyArgs]) (resp infer.FunctionResponse[GetPublicKeyResult], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	out, err := svc.GetPublicKey(ctx, &kms.GetPublicKeyInput{
+		KeyId:       aws.String(req.Input.KeyId),
+		GrantTokens: req.Input.GrantTokens,
+	})
+	if err != nil {
+		return
+	}
+
+	result := GetPublicKeyResult{
+		KeyId:        aws.ToString(out.KeyId),
+		PublicKey:    base64.StdEncoding.EncodeToString(out.PublicKey),
+		PublicKeyPem: publicKeyPem(out.PublicKey),
+		KeySpec:      string(out.KeySpec),
+		KeyUsage:     string(out.KeyUsage),
+	}
+	for _, algorithm := range out.SigningAlgorithms {
+		result.SigningAlgorithms = append(result.SigningAlgorithms, string(algorithm))
+	}
+	for _, algorithm := range out.EncryptionAlgorithms {
+		result.EncryptionAlgorithms = append(result.EncryptionAlgorithms, string(algorithm))
+	}
+	return infer.FunctionResponse[GetPublicKeyResult]{Output: result}, nil
+}
+
+type GetPublicKeyArgs struct {
+	KeyId       string   `pulumi:"keyId"`
+	GrantTokens []string `pulumi:"grantTokens,optional"`
+}
+
+func (g *GetPublicKeyArgs) Annotate(a infer.Annotator) {
+	a.Describe(&g.KeyId, "Identifies the asymmetric KMS key.")
+	a.Describe(&g.GrantTokens, "Grant tokens for a grant that is not yet eventually consistent.")
+}
+
+type GetPublicKeyResult struct {
+	KeyId                string   `pulumi:"keyId"`
+	PublicKey            string   `pulumi:"publicKey"`
+	PublicKeyPem         string   `pulumi:"publicKeyPem"`
+	KeySpec              string   `pulumi:"keySpec"`
+	KeyUsage             string   `pulumi:"keyUsage"`
+	SigningAlgorithms    []string `pulumi:"signingAlgorithms"`
+	EncryptionAlgorithms []string `pulumi:"encryptionAlgorithms"`
+}
+
+func (g *GetPublicKeyResult) Annotate(a infer.Annotator) {
+	a.Describe(&g.KeyId, "The ARN of the KMS key.")
+	a.Describe(&g.PublicKey, "The base64 encoded DER SubjectPublicKeyInfo of the public key.")
+	a.Describe(&g.PublicKeyPem, "The PEM encoded public key, e.g. for tls resources or openssl.")
+	a.Describe(&g.KeySpec, "The type of the key pair, e.g. RSA_2048 or ECC_NIST_P256.")
+	a.Describe(&g.KeyUsage, "What the key is used for. SIGN_VERIFY | ENCRYPT_DECRYPT")
+	a.Describe(&g.SigningAlgorithms, "The signing algorithms the key supports, empty unless keyUsage is SIGN_VERIFY.")
+	a.Describe(&g.EncryptionAlgorithms, "The encryption algorithms the key supports, empty unless keyUsage is ENCRYPT_DECRYPT.")
+}
+
+// publicKeyPem PEM encodes a DER SubjectPublicKeyInfo.
+func publicKeyPem(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// privateKeyPem PEM encodes a DER PKCS#8 private key.
+func privateKeyPem(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
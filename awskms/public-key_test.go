@@ -0,0 +1,49 @@
+package awskms
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestGetPublicKey(t *testing.T) {
+	server, fake := newServer(t)
+	if _, err := fake.Sign(context.Background(), &kms.SignInput{
+		KeyId:            aws.String("alias/signer"),
+		Message:          []byte("manifest"),
+		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPssSha256,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := invoke(t, server, "keygen:awskms:getPublicKey", map[string]property.Value{"keyId": property.New("alias/signer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := str(t, out, "keySpec"); got != "RSA_2048" {
+		t.Fatalf("expected an RSA_2048 key, got %s", got)
+	}
+	if got := str(t, out, "keyUsage"); got != "SIGN_VERIFY" {
+		t.Fatalf("expected a SIGN_VERIFY key, got %s", got)
+	}
+	if algorithms := out.Get("signingAlgorithms").AsArray(); algorithms.Len() != 6 {
+		t.Fatalf("expected the 6 RSA signing algorithms, got %v", algorithms)
+	}
+	block, _ := pem.Decode([]byte(str(t, out, "publicKeyPem")))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatal("expected publicKeyPem to be a PEM public key")
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		t.Fatalf("public key is not PKIX: %s", err)
+	}
+
+	if _, err := invoke(t, server, "keygen:awskms:getPublicKey", map[string]property.Value{"keyId": property.New("alias/missing")}); err == nil {
+		t.Fatal("expected the public key of an unknown key to fail")
+	}
+}
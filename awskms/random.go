@@ -3,12 +3,12 @@ package awskms
 import (
 	"context"
 	"encoding/base64"
-
-	"time"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
 	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
 )
@@ -20,40 +20,47 @@ func (f *Random) Annotate(a infer.Annotator) {
 }
 
 type RandomArgs struct {
-	NumberOfBytes       int    `pulumi:"numberOfBytes"`
-	ValidityPeriodHours int    `pulumi:"validityPeriodHours,optional"`
-	EarlyRenewalHours   int    `pulumi:"earlyRenewalHours,optional"`
-	CustomKeyStoreId    string `pulumi:"customKeyStoreId,optional"`
+	rotation.Args
+	NumberOfBytes    int    `pulumi:"numberOfBytes"`
+	CustomKeyStoreId string `pulumi:"customKeyStoreId,optional"`
 }
 
 func (f *RandomArgs) Annotate(a infer.Annotator) {
-	a.Describe(&f.NumberOfBytes, "Number of bytes to generate")
-	a.Describe(&f.ValidityPeriodHours, "Validity period in hours, after initial creation")
-	a.Describe(&f.EarlyRenewalHours, "Early renewal period in hours, before expiration")
+	a.Describe(&f.NumberOfBytes, "Number of bytes to generate, between 1 and 1024.")
 	a.Describe(&f.CustomKeyStoreId, "Custom key store ID")
 }
 
 type RandomState struct {
 	RandomArgs
 	PlainText string `pulumi:"plaintext" provider:"secret"`
-	Created   int64  `pulumi:"created"`
+	rotation.State
 }
 
 func (f *RandomState) Annotate(a infer.Annotator) {
 	a.Describe(&f.PlainText, "Random byte string")
-	a.Describe(&f.Created, "Timestamp of creation")
+}
+
+func (Random) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[RandomArgs], error) {
+	args, failures, err := infer.DefaultCheck[RandomArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[RandomArgs]{}, err
+	}
+	failures = append(failures, rotation.Validate(args.Args, rotation.Now(ctx))...)
+	if check.Known(req.NewInputs, "numberOfBytes") {
+		failures = append(failures, check.Range("numberOfBytes", args.NumberOfBytes, 1, 1024)...)
+	}
+	return infer.CheckResponse[RandomArgs]{Inputs: args, Failures: failures}, nil
 }
 
 func (r Random) Create(ctx context.Context, req infer.CreateRequest[RandomArgs]) (resp infer.CreateResponse[RandomState], err error) {
 	if req.DryRun {
 		return
 	}
-	cfg, err := config.LoadDefaultConfig(ctx)
+	svc, err := newClient(ctx)
 	if err != nil {
 		return
 	}
 
-	svc := kms.NewFromConfig(cfg)
 	input := &kms.GenerateRandomInput{
 		NumberOfBytes: aws.Int32(int32(req.Inputs.NumberOfBytes)),
 	}
@@ -69,11 +76,28 @@ func (r Random) Create(ctx context.Context, req infer.CreateRequest[RandomArgs])
 		ID: req.Name, Output: RandomState{
 			req.Inputs,
 			base64.StdEncoding.EncodeToString(rresp.Plaintext),
-			time.Now().Unix(),
+			rotation.New(req.Inputs.Args, rotation.Now(ctx)),
 		},
 	}, nil
 }
 
+func (Random) Read(ctx context.Context, req infer.ReadRequest[RandomArgs, RandomState]) (resp infer.ReadResponse[RandomArgs, RandomState], err error) {
+	decoded, err := base64.StdEncoding.DecodeString(req.State.PlainText)
+	if err != nil {
+		return resp, fmt.Errorf("plaintext of %s is not base64 encoded", req.ID)
+	}
+	if size := len(decoded); size != req.State.NumberOfBytes {
+		return resp, fmt.Errorf("plaintext of %s has incorrect(%d) size, expected %d", req.ID, size, req.State.NumberOfBytes)
+	}
+	state := req.State
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	return infer.ReadResponse[RandomArgs, RandomState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
+	}, nil
+}
+
 func (Random) Delete(ctx context.Context, req infer.DeleteRequest[RandomState]) (infer.DeleteResponse, error) {
 	return infer.DeleteResponse{}, nil
 }
@@ -86,29 +110,17 @@ func (Random) Update(ctx context.Context, req infer.UpdateRequest[RandomArgs, Ra
 		Output: RandomState{
 			req.Inputs,
 			req.State.PlainText,
-			req.State.Created,
+			rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx)),
 		},
 	}, nil
 }
 
 func (Random) Diff(ctx context.Context, req infer.DiffRequest[RandomArgs, RandomState]) (infer.DiffResponse, error) {
 	diff := map[string]p.PropertyDiff{}
-	if req.Inputs.EarlyRenewalHours != req.State.EarlyRenewalHours {
-		diff["earlyRenewalHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-	if req.Inputs.ValidityPeriodHours != req.State.ValidityPeriodHours {
-		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.Update}
-	}
-
 	if req.Inputs.NumberOfBytes != req.State.NumberOfBytes {
 		diff["numberOfBytes"] = p.PropertyDiff{Kind: p.UpdateReplace}
 	}
-	if req.Inputs.ValidityPeriodHours != 0 &&
-		time.Now().Unix() >=
-			req.State.Created+int64(req.Inputs.ValidityPeriodHours-req.Inputs.EarlyRenewalHours)*60*60 {
-		diff["expired"] = p.PropertyDiff{Kind: p.UpdateReplace}
-		p.GetLogger(ctx).Warningf("key %s is about to expire, will be replaced if perform this update!", req.ID)
-	}
+	rotation.Diff(ctx, req.ID, req.Inputs.Args, req.State.Args, req.State.State, diff)
 	return infer.DiffResponse{
 		DeleteBeforeReplace: false,
 		HasChanges:          len(diff) > 0,
@@ -119,4 +131,7 @@ func (Random) Diff(ctx context.Context, req infer.DiffRequest[RandomArgs, Random
 func (Random) WireDependencies(f infer.FieldSelector, args *RandomArgs, state *RandomState) {
 	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.CustomKeyStoreId))
 	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.NumberOfBytes))
+	f.OutputField(&state.PlainText).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+	f.OutputField(&state.PlainText).AlwaysSecret()
 }
@@ -0,0 +1,45 @@
+package awskms
+
+import (
+	"encoding/base64"
+	"testing"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestRandomLifecycle(t *testing.T) {
+	server, _ := newServer(t)
+	r := newResource(t, server, "keygen:awskms:Random")
+
+	inputs := map[string]property.Value{"numberOfBytes": property.New(32.0)}
+	state := r.create(inputs)
+	plaintext := str(t, state, "plaintext")
+	if b, err := base64.StdEncoding.DecodeString(plaintext); err != nil || len(b) != 32 {
+		t.Fatalf("expected 32 random bytes, got %d (%v)", len(b), err)
+	}
+
+	if diff := r.diff(inputs); diff.HasChanges {
+		t.Fatalf("expected no changes, got %v", diff.DetailedDiff)
+	}
+	if got := diffKinds(r.diff(map[string]property.Value{"numberOfBytes": property.New(16.0)})); got["numberOfBytes"] != p.UpdateReplace {
+		t.Fatalf("expected numberOfBytes to replace, got %v", got)
+	}
+
+	longer := map[string]property.Value{"numberOfBytes": property.New(32.0), "validityPeriodHours": property.New(24.0)}
+	if got := diffKinds(r.diff(longer)); got["validityPeriodHours"] != p.Update || len(got) != 1 {
+		t.Fatalf("expected validityPeriodHours to update in place, got %v", got)
+	}
+	state = r.update(longer)
+	if str(t, state, "plaintext") != plaintext {
+		t.Fatal("expected update to keep the random bytes")
+	}
+	if state.Get("expiresAt").AsString() == "" {
+		t.Fatal("expected expiresAt once validityPeriodHours is set")
+	}
+
+	if _, err := r.read(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	r.delete()
+}
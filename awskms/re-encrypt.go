@@ -0,0 +1,227 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type ReEncrypt struct{}
+
+func (r *ReEncrypt) Annotate(a infer.Annotator) {
+	a.Describe(r, "ReEncrypt decrypts a ciphertext and encrypts it again under another KMS key or encryption context, entirely inside KMS so the plaintext is never exposed.")
+}
+
+func (ReEncrypt) Invoke(ctx context.Context, req infer.FunctionRequest[ReEncryptArgs]) (resp infer.FunctionResponse[ReEncryptResult], err error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(req.Input.Ciphertext)
+	if err != nil {
+		return resp, fmt.Errorf("ciphertext is not base64 encoded")
+	}
+	out, err := reEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:               ciphertext,
+		SourceKeyId:                  optionalString(req.Input.SourceKeyId),
+		SourceEncryptionContext:      req.Input.SourceEncryptionContext,
+		DestinationKeyId:             aws.String(req.Input.DestinationKeyId),
+		DestinationEncryptionContext: req.Input.DestinationEncryptionContext,
+		GrantTokens:                  req.Input.GrantTokens,
+	})
+	if err != nil {
+		return
+	}
+	return infer.FunctionResponse[ReEncryptResult]{
+		Output: ReEncryptResult{
+			Result:      base64.StdEncoding.EncodeToString(out.CiphertextBlob),
+			SourceKeyId: aws.ToString(out.SourceKeyId),
+		},
+	}, nil
+}
+
+type ReEncryptArgs struct {
+	Ciphertext                   string            `pulumi:"ciphertext"`
+	SourceKeyId                  string            `pulumi:"sourceKeyId,optional"`
+	SourceEncryptionContext      map[string]string `pulumi:"sourceEncryptionContext,optional"`
+	DestinationKeyId             string            `pulumi:"destinationKeyId"`
+	DestinationEncryptionContext map[string]string `pulumi:"destinationEncryptionContext,optional"`
+	GrantTokens                  []string          `pulumi:"grantTokens,optional"`
+}
+
+func (r *ReEncryptArgs) Annotate(a infer.Annotator) {
+	a.Describe(&r.Ciphertext, "The base64 encoded ciphertext to re-encrypt, e.g. the result of awskms.Encrypt or the ciphertextBlob of a DataKey.")
+	a.Describe(&r.SourceKeyId, "The KMS key the ciphertext was encrypted with, only required for asymmetric keys but checked when given.")
+	a.Describe(&r.SourceEncryptionContext, "The encryption context the ciphertext was encrypted with.")
+	a.Describe(&r.DestinationKeyId, "The KMS key to re-encrypt the ciphertext under, it may be the source key to only change the encryption context.")
+	a.Describe(&r.DestinationEncryptionContext, "Key-value pairs bound to the new ciphertext, the same context must be provided to decrypt it.")
+	a.Describe(&r.GrantTokens, "Grant tokens for a grant that is not yet eventually consistent.")
+}
+
+type ReEncryptResult struct {
+	Result      string `pulumi:"result"`
+	SourceKeyId string `pulumi:"sourceKeyId"`
+}
+
+func (r *ReEncryptResult) Annotate(a infer.Annotator) {
+	a.Describe(&r.Result, "The base64 encoded ciphertext under the destination key.")
+	a.Describe(&r.SourceKeyId, "The ARN of the KMS key the ciphertext was encrypted with.")
+}
+
+type ReEncryptedBlob struct{}
+
+func (f *ReEncryptedBlob) Annotate(a infer.Annotator) {
+	a.Describe(&f, "A ciphertext re-encrypted under another KMS key or encryption context inside KMS, to migrate ciphertext between keys as a reviewable diff. Deleting it leaves the source ciphertext untouched.")
+}
+
+type ReEncryptedBlobArgs struct {
+	SourceCiphertextBlob         string            `pulumi:"sourceCiphertextBlob"`
+	SourceKeyId                  string            `pulumi:"sourceKeyId,optional"`
+	SourceEncryptionContext      map[string]string `pulumi:"sourceEncryptionContext,optional"`
+	DestinationKeyId             string            `pulumi:"destinationKeyId"`
+	DestinationEncryptionContext map[string]string `pulumi:"destinationEncryptionContext,optional"`
+	GrantTokens                  []string          `pulumi:"grantTokens,optional"`
+}
+
+func (f *ReEncryptedBlobArgs) Annotate(a infer.Annotator) {
+	a.Describe(&f.SourceCiphertextBlob, "The base64 encoded ciphertext to re-encrypt, e.g. the ciphertextBlob of a DataKey.")
+	a.Describe(&f.SourceKeyId, "The KMS key the ciphertext was encrypted with, only required for asymmetric keys but checked when given.")
+	a.Describe(&f.SourceEncryptionContext, "The encryption context the ciphertext was encrypted with.")
+	a.Describe(&f.DestinationKeyId, "The KMS key to re-encrypt the ciphertext under.")
+	a.Describe(&f.DestinationEncryptionContext, "Key-value pairs bound to the new ciphertext blob, the same context must be provided to decrypt it.")
+	a.Describe(&f.GrantTokens, "Grant tokens for a grant that is not yet eventually consistent.")
+}
+
+type ReEncryptedBlobState struct {
+	ReEncryptedBlobArgs
+	CiphertextBlob string `pulumi:"ciphertextBlob"`
+}
+
+func (f *ReEncryptedBlobState) Annotate(a infer.Annotator) {
+	a.Describe(&f.CiphertextBlob, "The base64 encoded ciphertext under the destination key.")
+}
+
+func (ReEncryptedBlob) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[ReEncryptedBlobArgs], error) {
+	args, failures, err := infer.DefaultCheck[ReEncryptedBlobArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[ReEncryptedBlobArgs]{}, err
+	}
+	if check.Known(req.NewInputs, "sourceCiphertextBlob") {
+		if _, err := base64.StdEncoding.DecodeString(args.SourceCiphertextBlob); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "sourceCiphertextBlob", Reason: "is not base64 encoded"})
+		} else {
+			failures = append(failures, check.NotEmpty("sourceCiphertextBlob", args.SourceCiphertextBlob)...)
+		}
+	}
+	if check.Known(req.NewInputs, "destinationKeyId") {
+		failures = append(failures, check.NotEmpty("destinationKeyId", args.DestinationKeyId)...)
+	}
+	return infer.CheckResponse[ReEncryptedBlobArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (ReEncryptedBlob) Create(ctx context.Context, req infer.CreateRequest[ReEncryptedBlobArgs]) (resp infer.CreateResponse[ReEncryptedBlobState], err error) {
+	if req.DryRun {
+		return
+	}
+	blob, err := base64.StdEncoding.DecodeString(req.Inputs.SourceCiphertextBlob)
+	if err != nil {
+		return resp, fmt.Errorf("sourceCiphertextBlob is not base64 encoded")
+	}
+	out, err := reEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:               blob,
+		SourceKeyId:                  optionalString(req.Inputs.SourceKeyId),
+		SourceEncryptionContext:      req.Inputs.SourceEncryptionContext,
+		DestinationKeyId:             aws.String(req.Inputs.DestinationKeyId),
+		DestinationEncryptionContext: req.Inputs.DestinationEncryptionContext,
+		GrantTokens:                  req.Inputs.GrantTokens,
+	})
+	if err != nil {
+		return
+	}
+	return infer.CreateResponse[ReEncryptedBlobState]{
+		ID: req.Name,
+		Output: ReEncryptedBlobState{
+			req.Inputs,
+			base64.StdEncoding.EncodeToString(out.CiphertextBlob),
+		},
+	}, nil
+}
+
+// Read only checks the destination key, decrypting the blob would expose its plaintext.
+func (ReEncryptedBlob) Read(ctx context.Context, req infer.ReadRequest[ReEncryptedBlobArgs, ReEncryptedBlobState]) (resp infer.ReadResponse[ReEncryptedBlobArgs, ReEncryptedBlobState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.DestinationKeyId); err != nil {
+		return
+	}
+	return infer.ReadResponse[ReEncryptedBlobArgs, ReEncryptedBlobState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  req.State,
+	}, nil
+}
+
+func (ReEncryptedBlob) Delete(ctx context.Context, req infer.DeleteRequest[ReEncryptedBlobState]) (infer.DeleteResponse, error) {
+	return infer.DeleteResponse{}, nil
+}
+
+func (ReEncryptedBlob) Diff(ctx context.Context, req infer.DiffRequest[ReEncryptedBlobArgs, ReEncryptedBlobState]) (infer.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+	if req.Inputs.SourceCiphertextBlob != req.State.SourceCiphertextBlob {
+		diff["sourceCiphertextBlob"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.SourceKeyId != req.State.SourceKeyId {
+		diff["sourceKeyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !maps.Equal(req.Inputs.SourceEncryptionContext, req.State.SourceEncryptionContext) {
+		diff["sourceEncryptionContext"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.DestinationKeyId != req.State.DestinationKeyId {
+		diff["destinationKeyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if !maps.Equal(req.Inputs.DestinationEncryptionContext, req.State.DestinationEncryptionContext) {
+		diff["destinationEncryptionContext"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	return infer.DiffResponse{
+		DeleteBeforeReplace: false,
+		HasChanges:          len(diff) > 0,
+		DetailedDiff:        diff,
+	}, nil
+}
+
+func (ReEncryptedBlob) WireDependencies(f infer.FieldSelector, args *ReEncryptedBlobArgs, state *ReEncryptedBlobState) {
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.SourceCiphertextBlob))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.SourceKeyId))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.SourceEncryptionContext))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.DestinationKeyId))
+	f.OutputField(&state.CiphertextBlob).DependsOn(f.InputField(&args.DestinationEncryptionContext))
+}
+
+// reEncrypt migrates a ciphertext inside KMS, with a hint at the source encryption
+// context when the ciphertext can't be decrypted.
+func reEncrypt(ctx context.Context, input *kms.ReEncryptInput) (*kms.ReEncryptOutput, error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := svc.ReEncrypt(ctx, input)
+	var invalid *types.InvalidCiphertextException
+	if errors.As(err, &invalid) {
+		return nil, fmt.Errorf("failed to decrypt ciphertext, check that sourceEncryptionContext matches the one used to encrypt it: %w", err)
+	}
+	return out, err
+}
+
+func optionalString(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,111 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestReEncryptedBlobLifecycle(t *testing.T) {
+	server, fake := newServer(t)
+	enc, err := fake.Encrypt(context.Background(), &kms.EncryptInput{
+		KeyId:             aws.String("alias/old"),
+		Plaintext:         []byte("hello"),
+		EncryptionContext: map[string]string{"stack": "dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := property.New(base64.StdEncoding.EncodeToString(enc.CiphertextBlob))
+	sourceContext := property.New(property.NewMap(map[string]property.Value{"stack": property.New("dev")}))
+
+	r := newResource(t, server, "keygen:awskms:ReEncryptedBlob")
+	inputs := map[string]property.Value{
+		"sourceCiphertextBlob":    source,
+		"sourceEncryptionContext": sourceContext,
+		"destinationKeyId":        property.New("alias/new"),
+	}
+	state := r.create(inputs)
+	blob, err := base64.StdEncoding.DecodeString(str(t, state, "ciphertextBlob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := fake.Decrypt(context.Background(), &kms.DecryptInput{KeyId: aws.String("alias/new"), CiphertextBlob: blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Plaintext) != "hello" {
+		t.Fatalf("expected the re-encrypted blob to decrypt to hello, got %q", out.Plaintext)
+	}
+
+	if diff := r.diff(inputs); diff.HasChanges {
+		t.Fatalf("expected no changes, got %v", diff.DetailedDiff)
+	}
+	if got := diffKinds(r.diff(map[string]property.Value{
+		"sourceCiphertextBlob":         source,
+		"sourceEncryptionContext":      sourceContext,
+		"destinationKeyId":             property.New("alias/new"),
+		"destinationEncryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("prod")})),
+	})); got["destinationEncryptionContext"] != p.UpdateReplace || len(got) != 1 {
+		t.Fatalf("expected destinationEncryptionContext to replace, got %v", got)
+	}
+
+	if _, err := r.read(); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	fake.SetKeyState("alias/new", types.KeyStateDisabled)
+	if _, err := r.read(); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("expected read of a disabled destination key to fail, got %v", err)
+	}
+	r.delete()
+}
+
+func TestReEncrypt(t *testing.T) {
+	server, _ := newServer(t)
+	plaintext := base64.StdEncoding.EncodeToString([]byte("hello"))
+	encrypted, err := invoke(t, server, "keygen:awskms:encrypt", map[string]property.Value{
+		"keyId":     property.New("alias/old"),
+		"plaintext": property.New(plaintext),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reEncrypted, err := invoke(t, server, "keygen:awskms:reEncrypt", map[string]property.Value{
+		"ciphertext":                   encrypted.Get("result"),
+		"destinationKeyId":             property.New("alias/new"),
+		"destinationEncryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("prod")})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := str(t, reEncrypted, "sourceKeyId"); got != "alias/old" {
+		t.Fatalf("expected source key alias/old, got %s", got)
+	}
+	decrypted, err := invoke(t, server, "keygen:awskms:decrypt", map[string]property.Value{
+		"ciphertext":        reEncrypted.Get("result"),
+		"encryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("prod")})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := str(t, decrypted, "result"); got != plaintext {
+		t.Fatalf("expected %s, got %s", plaintext, got)
+	}
+
+	_, err = invoke(t, server, "keygen:awskms:reEncrypt", map[string]property.Value{
+		"ciphertext":              encrypted.Get("result"),
+		"sourceEncryptionContext": property.New(property.NewMap(map[string]property.Value{"stack": property.New("dev")})),
+		"destinationKeyId":        property.New("alias/new"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "sourceEncryptionContext") {
+		t.Fatalf("expected re-encrypt with another sourceEncryptionContext to fail, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package awskms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/rotation"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type SelfSignedCert struct{}
+
+func (f *SelfSignedCert) Annotate(a infer.Annotator) {
+	a.Describe(&f, "A self-signed X.509 certificate whose private key never leaves KMS, e.g. the root of a certificate authority")
+}
+
+type SelfSignedCertArgs struct {
+	rotation.Args
+	CertIdentity
+	CertOptions
+	KeyId string `pulumi:"keyId"`
+}
+
+func (f *SelfSignedCertArgs) Annotate(a infer.Annotator) {
+	a.Describe(&f.KeyId, "The asymmetric KMS key the certificate is issued to and signed by, its key usage must be SIGN_VERIFY.")
+}
+
+type SelfSignedCertState struct {
+	SelfSignedCertArgs
+	CertPem string `pulumi:"certPem"`
+	rotation.State
+}
+
+func (f *SelfSignedCertState) Annotate(a infer.Annotator) {
+	a.Describe(&f.CertPem, "The PEM encoded certificate, valid from created until expiresAt.")
+}
+
+func (SelfSignedCert) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[SelfSignedCertArgs], error) {
+	args, failures, err := infer.DefaultCheck[SelfSignedCertArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[SelfSignedCertArgs]{}, err
+	}
+	if check.Known(req.NewInputs, "keyId") {
+		failures = append(failures, check.NotEmpty("keyId", args.KeyId)...)
+	}
+	failures = append(failures, args.CertIdentity.validate(req.NewInputs)...)
+	failures = append(failures, args.CertOptions.validate(ctx, req.NewInputs, args.Args)...)
+	return infer.CheckResponse[SelfSignedCertArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (SelfSignedCert) Create(ctx context.Context, req infer.CreateRequest[SelfSignedCertArgs]) (resp infer.CreateResponse[SelfSignedCertState], err error) {
+	if req.DryRun {
+		return
+	}
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	s, err := newSigner(ctx, svc, req.Inputs.KeyId, req.Inputs.SigningAlgorithm)
+	if err != nil {
+		return
+	}
+
+	state := SelfSignedCertState{
+		SelfSignedCertArgs: req.Inputs,
+		State:              rotation.New(req.Inputs.Args, rotation.Now(ctx)),
+	}
+	template, err := req.Inputs.CertOptions.template(state.State)
+	if err != nil {
+		return
+	}
+	template.Subject = req.Inputs.Subject.name()
+	template.DNSNames = req.Inputs.DnsNames
+	template.IPAddresses = req.Inputs.ips()
+	template.EmailAddresses = req.Inputs.EmailAddresses
+	if template.URIs, err = req.Inputs.uris(); err != nil {
+		return
+	}
+	template.SignatureAlgorithm = s.signatureAlgorithm()
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, s.Public(), s)
+	if err != nil {
+		return resp, fmt.Errorf("failed to sign certificate with %s: %w", req.Inputs.KeyId, err)
+	}
+	state.CertPem = certPem(der)
+	return infer.CreateResponse[SelfSignedCertState]{ID: req.Name, Output: state}, nil
+}
+
+func (SelfSignedCert) Read(ctx context.Context, req infer.ReadRequest[SelfSignedCertArgs, SelfSignedCertState]) (resp infer.ReadResponse[SelfSignedCertArgs, SelfSignedCertState], err error) {
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+	if err = checkKeyEnabled(ctx, svc, req.State.KeyId); err != nil {
+		return
+	}
+	if _, err = parseCertPem(req.State.CertPem); err != nil {
+		return resp, fmt.Errorf("certPem of %s %s", req.ID, err)
+	}
+	state := req.State
+	state.State = rotation.Refresh(state.Args, state.Created, rotation.Now(ctx))
+	return infer.ReadResponse[SelfSignedCertArgs, SelfSignedCertState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
+	}, nil
+}
+
+func (SelfSignedCert) Delete(ctx context.Context, req infer.DeleteRequest[SelfSignedCertState]) (infer.DeleteResponse, error) {
+	return infer.DeleteResponse{}, nil
+}
+
+func (SelfSignedCert) Update(ctx context.Context, req infer.UpdateRequest[SelfSignedCertArgs, SelfSignedCertState]) (infer.UpdateResponse[SelfSignedCertState], error) {
+	if req.DryRun {
+		return infer.UpdateResponse[SelfSignedCertState]{}, nil
+	}
+	state := req.State
+	state.SelfSignedCertArgs = req.Inputs
+	state.State = rotation.Refresh(req.Inputs.Args, req.State.Created, rotation.Now(ctx))
+	return infer.UpdateResponse[SelfSignedCertState]{Output: state}, nil
+}
+
+func (SelfSignedCert) Diff(ctx context.Context, req infer.DiffRequest[SelfSignedCertArgs, SelfSignedCertState]) (infer.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+	if req.Inputs.KeyId != req.State.KeyId {
+		diff["keyId"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	req.Inputs.CertIdentity.diff(req.State.CertIdentity, diff)
+	req.Inputs.CertOptions.diff(ctx, req.ID, req.State.CertOptions, req.Inputs.Args, req.State.Args, req.State.State, diff)
+	return infer.DiffResponse{
+		DeleteBeforeReplace: false,
+		HasChanges:          len(diff) > 0,
+		DetailedDiff:        diff,
+	}, nil
+}
+
+func (SelfSignedCert) WireDependencies(f infer.FieldSelector, args *SelfSignedCertArgs, state *SelfSignedCertState) {
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.KeyId))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.Subject))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.DnsNames))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.IpAddresses))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.Uris))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.EmailAddresses))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.AllowedUses))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.IsCaCertificate))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.SigningAlgorithm))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.ValidityPeriodHours))
+	f.OutputField(&state.CertPem).DependsOn(f.InputField(&args.Triggers))
+	f.OutputField(&state.NextRotation).DependsOn(f.InputField(&args.RotationSchedule))
+}
@@ -0,0 +1,178 @@
+package awskms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/encoding"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type Sign struct{}
+
+func (s *Sign) Annotate(a infer.Annotator) {
+	a.Describe(s, "Sign signs a message or message digest with an asymmetric KMS key, the private key never leaves KMS.")
+}
+
+func (Sign) Invoke(ctx context.Context, req infer.FunctionRequest[SignArgs]) (resp infer.FunctionResponse[SignResult], err error) {
+	message, err := signingMessage(req.Input.Message, req.Input.MessageEncoding, req.Input.MessageType, req.Input.SigningAlgorithm)
+	if err != nil {
+		return
+	}
+
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	out, err := svc.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(req.Input.KeyId),
+		Message:          message,
+		MessageType:      messageTypeOrDefault(req.Input.MessageType),
+		SigningAlgorithm: req.Input.SigningAlgorithm,
+	})
+	if err != nil {
+		return
+	}
+
+	return infer.FunctionResponse[SignResult]{
+		Output: SignResult{
+			Signature: base64.StdEncoding.EncodeToString(out.Signature),
+			KeyId:     aws.ToString(out.KeyId),
+		},
+	}, nil
+}
+
+type SignArgs struct {
+	KeyId            string                     `pulumi:"keyId"`
+	Message          string                     `pulumi:"message"`
+	MessageEncoding  string                     `pulumi:"messageEncoding,optional"`
+	MessageType      types.MessageType          `pulumi:"messageType,optional"`
+	SigningAlgorithm types.SigningAlgorithmSpec `pulumi:"signingAlgorithm"`
+}
+
+func (s *SignArgs) Annotate(a infer.Annotator) {
+	a.Describe(&s.KeyId, "Identifies the asymmetric KMS key to sign with, its key usage must be SIGN_VERIFY.")
+	a.Describe(&s.Message, "The message or message digest to sign.")
+	a.Describe(&s.MessageEncoding, "How message is encoded, use base64 or hex for binary data and digests. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&s.MessageType, "Whether message is the message itself, hashed by KMS, or a digest of it. RAW | DIGEST. A RAW message must be at most 4096 bytes. Default is RAW.")
+	a.Describe(&s.SigningAlgorithm, "The signing algorithm, it must be supported by the key spec of the KMS key. RSASSA_PSS_SHA_256 | RSASSA_PSS_SHA_384 | RSASSA_PSS_SHA_512 | RSASSA_PKCS1_V1_5_SHA_256 | RSASSA_PKCS1_V1_5_SHA_384 | RSASSA_PKCS1_V1_5_SHA_512 | ECDSA_SHA_256 | ECDSA_SHA_384 | ECDSA_SHA_512 | SM2DSA")
+}
+
+type SignResult struct {
+	Signature string `pulumi:"signature"`
+	KeyId     string `pulumi:"keyId"`
+}
+
+func (s *SignResult) Annotate(a infer.Annotator) {
+	a.Describe(&s.Signature, "The base64 encoded signature, DER encoded for ECDSA and SM2DSA.")
+	a.Describe(&s.KeyId, "The ARN of the KMS key that signed the message.")
+}
+
+type Verify struct{}
+
+func (v *Verify) Annotate(a infer.Annotator) {
+	a.Describe(v, "Verify verifies a signature made by Sign or any other signer of an asymmetric KMS key.")
+}
+
+func (Verify) Invoke(ctx context.Context, req infer.FunctionRequest[VerifyArgs]) (resp infer.FunctionResponse[VerifyResult], err error) {
+	message, err := signingMessage(req.Input.Message, req.Input.MessageEncoding, req.Input.MessageType, req.Input.SigningAlgorithm)
+	if err != nil {
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(req.Input.Signature)
+	if err != nil {
+		return resp, fmt.Errorf("signature is not base64 encoded")
+	}
+
+	svc, err := newClient(ctx)
+	if err != nil {
+		return
+	}
+
+	out, err := svc.Verify(ctx, &kms.VerifyInput{
+		KeyId:            aws.String(req.Input.KeyId),
+		Message:          message,
+		MessageType:      messageTypeOrDefault(req.Input.MessageType),
+		Signature:        signature,
+		SigningAlgorithm: req.Input.SigningAlgorithm,
+	})
+	var invalid *types.KMSInvalidSignatureException
+	if errors.As(err, &invalid) {
+		// KMS fails on an invalid signature, report it as the result instead
+		return infer.FunctionResponse[VerifyResult]{Output: VerifyResult{Valid: false}}, nil
+	}
+	if err != nil {
+		return
+	}
+	return infer.FunctionResponse[VerifyResult]{
+		Output: VerifyResult{Valid: out.SignatureValid},
+	}, nil
+}
+
+type VerifyArgs struct {
+	KeyId            string                     `pulumi:"keyId"`
+	Message          string                     `pulumi:"message"`
+	MessageEncoding  string                     `pulumi:"messageEncoding,optional"`
+	MessageType      types.MessageType          `pulumi:"messageType,optional"`
+	Signature        string                     `pulumi:"signature"`
+	SigningAlgorithm types.SigningAlgorithmSpec `pulumi:"signingAlgorithm"`
+}
+
+func (v *VerifyArgs) Annotate(a infer.Annotator) {
+	a.Describe(&v.KeyId, "Identifies the asymmetric KMS key that made the signature.")
+	a.Describe(&v.Message, "The message or message digest that was signed.")
+	a.Describe(&v.MessageEncoding, "How message is encoded, use base64 or hex for binary data and digests. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&v.MessageType, "Whether message is the message itself or a digest of it. RAW | DIGEST. Default is RAW.")
+	a.Describe(&v.Signature, "The base64 encoded signature to verify.")
+	a.Describe(&v.SigningAlgorithm, "The signing algorithm the signature was made with.")
+}
+
+type VerifyResult struct {
+	Valid bool `pulumi:"valid"`
+}
+
+func (v *VerifyResult) Annotate(a infer.Annotator) {
+	a.Describe(&v.Valid, "Whether the signature is valid for the message and key.")
+}
+
+// signingMessage decodes the message of a Sign or Verify request, only a RAW message is
+// limited in size, a DIGEST is checked against the algorithm by KMS.
+func signingMessage(message, messageEncoding string, messageType types.MessageType, algorithm types.SigningAlgorithmSpec) ([]byte, error) {
+	if messageType = messageTypeOrDefault(messageType); !slices.Contains(messageType.Values(), messageType) {
+		return nil, fmt.Errorf("unknown messageType %s, must be one of RAW, DIGEST", messageType)
+	}
+	return decodeMessage("signingAlgorithm", algorithm, message, messageEncoding, messageType == types.MessageTypeRaw)
+}
+
+// decodeMessage decodes the message of a sign or mac request after validating the
+// algorithm and size, which KMS would otherwise reject with a less helpful error.
+func decodeMessage[A interface {
+	~string
+	Values() []A
+}](property string, algorithm A, message, messageEncoding string, limited bool) ([]byte, error) {
+	if !slices.Contains(algorithm.Values(), algorithm) {
+		return nil, fmt.Errorf("unknown %s %s, must be one of %v", property, algorithm, algorithm.Values())
+	}
+	b, err := encoding.Decode(messageEncoding, message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message: %s", err)
+	}
+	if limited && len(b) > 4096 {
+		return nil, fmt.Errorf("message must be at most 4096 bytes, got %d", len(b))
+	}
+	return b, nil
+}
+
+func messageTypeOrDefault(t types.MessageType) types.MessageType {
+	if len(t) == 0 {
+		return types.MessageTypeRaw
+	}
+	return t
+}
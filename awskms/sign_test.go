@@ -0,0 +1,76 @@
+package awskms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+func TestSignVerify(t *testing.T) {
+	server, _ := newServer(t)
+	sign := func(args map[string]property.Value) string {
+		t.Helper()
+		out, err := invoke(t, server, "keygen:awskms:sign", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return str(t, out, "signature")
+	}
+	verify := func(args map[string]property.Value) bool {
+		t.Helper()
+		out, err := invoke(t, server, "keygen:awskms:verify", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Get("valid").AsBool()
+	}
+
+	signature := sign(map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("release manifest"),
+		"signingAlgorithm": property.New("RSASSA_PSS_SHA_256"),
+	})
+	if !verify(map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("release manifest"),
+		"signature":        property.New(signature),
+		"signingAlgorithm": property.New("RSASSA_PSS_SHA_256"),
+	}) {
+		t.Fatal("expected the signature to be valid")
+	}
+	if verify(map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("tampered manifest"),
+		"signature":        property.New(signature),
+		"signingAlgorithm": property.New("RSASSA_PSS_SHA_256"),
+	}) {
+		t.Fatal("expected the signature of another message to be invalid")
+	}
+
+	digest := sha256.Sum256([]byte("release manifest"))
+	signature = sign(map[string]property.Value{
+		"keyId":            property.New("alias/ecdsa"),
+		"message":          property.New(hex.EncodeToString(digest[:])),
+		"messageEncoding":  property.New("hex"),
+		"messageType":      property.New("DIGEST"),
+		"signingAlgorithm": property.New("ECDSA_SHA_256"),
+	})
+	if !verify(map[string]property.Value{
+		"keyId":            property.New("alias/ecdsa"),
+		"message":          property.New("release manifest"),
+		"signature":        property.New(signature),
+		"signingAlgorithm": property.New("ECDSA_SHA_256"),
+	}) {
+		t.Fatal("expected the digest signature to verify the message")
+	}
+
+	if _, err := invoke(t, server, "keygen:awskms:sign", map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("release manifest"),
+		"signingAlgorithm": property.New("ECDSA_SHA_1"),
+	}); err == nil {
+		t.Fatal("expected an unknown signingAlgorithm to fail")
+	}
+}
@@ -0,0 +1,126 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// certSigningAlgorithm is what a KMS signing algorithm means for x509.
+type certSigningAlgorithm struct {
+	x509 x509.SignatureAlgorithm
+	hash crypto.Hash
+	pss  bool
+}
+
+// certSigningAlgorithms are the KMS signing algorithms x509 certificates can be signed
+// with, SM2DSA is not supported by crypto/x509.
+var certSigningAlgorithms = map[types.SigningAlgorithmSpec]certSigningAlgorithm{
+	types.SigningAlgorithmSpecRsassaPssSha256:      {x509.SHA256WithRSAPSS, crypto.SHA256, true},
+	types.SigningAlgorithmSpecRsassaPssSha384:      {x509.SHA384WithRSAPSS, crypto.SHA384, true},
+	types.SigningAlgorithmSpecRsassaPssSha512:      {x509.SHA512WithRSAPSS, crypto.SHA512, true},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha256: {x509.SHA256WithRSA, crypto.SHA256, false},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha384: {x509.SHA384WithRSA, crypto.SHA384, false},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha512: {x509.SHA512WithRSA, crypto.SHA512, false},
+	types.SigningAlgorithmSpecEcdsaSha256:          {x509.ECDSAWithSHA256, crypto.SHA256, false},
+	types.SigningAlgorithmSpecEcdsaSha384:          {x509.ECDSAWithSHA384, crypto.SHA384, false},
+	types.SigningAlgorithmSpecEcdsaSha512:          {x509.ECDSAWithSHA512, crypto.SHA512, false},
+}
+
+// certSigningAlgorithmValues returns the algorithms of certSigningAlgorithms in the order KMS lists them.
+func certSigningAlgorithmValues() []types.SigningAlgorithmSpec {
+	var values []types.SigningAlgorithmSpec
+	for _, algorithm := range types.SigningAlgorithmSpec("").Values() {
+		if _, ok := certSigningAlgorithms[algorithm]; ok {
+			values = append(values, algorithm)
+		}
+	}
+	return values
+}
+
+// defaultCertSigningAlgorithm is the algorithm a key of spec signs certificates with when
+// none is given, the one x509 itself would pick for the key.
+func defaultCertSigningAlgorithm(spec types.KeySpec) types.SigningAlgorithmSpec {
+	switch spec {
+	case types.KeySpecRsa2048, types.KeySpecRsa3072, types.KeySpecRsa4096:
+		return types.SigningAlgorithmSpecRsassaPkcs1V15Sha256
+	case types.KeySpecEccNistP256:
+		return types.SigningAlgorithmSpecEcdsaSha256
+	case types.KeySpecEccNistP384:
+		return types.SigningAlgorithmSpecEcdsaSha384
+	case types.KeySpecEccNistP521:
+		return types.SigningAlgorithmSpecEcdsaSha512
+	}
+	return ""
+}
+
+// signer is a crypto.Signer whose private key never leaves KMS, every signature is a KMS
+// Sign of the digest. crypto.Signer has no context, so the signer keeps the one it was
+// created with.
+type signer struct {
+	ctx       context.Context
+	svc       KMS
+	keyId     string
+	public    crypto.PublicKey
+	spec      types.SigningAlgorithmSpec
+	algorithm certSigningAlgorithm
+}
+
+// newSigner returns a signer for the asymmetric KMS key keyId that signs with algorithm,
+// or with the default algorithm of its key spec when algorithm is empty.
+func newSigner(ctx context.Context, svc KMS, keyId string, algorithm types.SigningAlgorithmSpec) (*signer, error) {
+	out, err := svc.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyId)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the public key of %s: %w", keyId, err)
+	}
+	if out.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("key %s cannot sign certificates, its key usage is %s", keyId, out.KeyUsage)
+	}
+	public, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s key %s cannot sign certificates: %w", out.KeySpec, keyId, err)
+	}
+	if len(algorithm) == 0 {
+		algorithm = defaultCertSigningAlgorithm(out.KeySpec)
+	}
+	a, ok := certSigningAlgorithms[algorithm]
+	if !ok || !slices.Contains(out.SigningAlgorithms, algorithm) {
+		return nil, fmt.Errorf("%s key %s cannot sign certificates with %q, it signs with %v", out.KeySpec, keyId, algorithm, out.SigningAlgorithms)
+	}
+	return &signer{ctx: ctx, svc: svc, keyId: keyId, public: public, spec: algorithm, algorithm: a}, nil
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs digest with KMS, opts must match the signing algorithm of the signer which
+// x509 is told to use through signatureAlgorithm.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	_, pss := opts.(*rsa.PSSOptions)
+	if opts.HashFunc() != s.algorithm.hash || pss != s.algorithm.pss {
+		return nil, fmt.Errorf("key %s signs with %s, not %s", s.keyId, s.spec, opts.HashFunc())
+	}
+	out, err := s.svc.Sign(s.ctx, &kms.SignInput{
+		KeyId:            aws.String(s.keyId),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: s.spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
+
+func (s *signer) signatureAlgorithm() x509.SignatureAlgorithm {
+	return s.algorithm.x509
+}
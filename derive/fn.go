@@ -0,0 +1,31 @@
+package derive
+
+import (
+	"context"
+
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type DeriveKey struct{}
+
+func (r *DeriveKey) Annotate(a infer.Annotator) {
+	a.Describe(r, "DeriveKey derives a key with HKDF from a master secret without keeping it in state.")
+}
+
+func (DeriveKey) Invoke(_ context.Context, req infer.FunctionRequest[KeyArgs]) (resp infer.FunctionResponse[DeriveKeyResult], err error) {
+	key, recipient, err := deriveKey(req.Input)
+	if err != nil {
+		return
+	}
+	return infer.FunctionResponse[DeriveKeyResult]{Output: DeriveKeyResult{key, recipient}}, nil
+}
+
+type DeriveKeyResult struct {
+	Key       string `pulumi:"key" provider:"secret"`
+	Recipient string `pulumi:"recipient,optional"`
+}
+
+func (r *DeriveKeyResult) Annotate(a infer.Annotator) {
+	a.Describe(&r.Key, "The derived key in the requested format")
+	a.Describe(&r.Recipient, "The age recipient of the derived key, only set for the age format")
+}
@@ -0,0 +1,292 @@
+package derive
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"filippo.io/age"
+	"github.com/jcouyang/pulumi-keygen/internal/bech32"
+	"github.com/jcouyang/pulumi-keygen/internal/check"
+	"github.com/jcouyang/pulumi-keygen/internal/encoding"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+const (
+	HashSHA256 = "SHA256"
+	HashSHA512 = "SHA512"
+
+	FormatBase64 = "base64"
+	FormatHex    = "hex"
+	FormatAge    = "age"
+)
+
+type Key struct{}
+
+func (f *Key) Annotate(a infer.Annotator) {
+	a.Describe(&f, "A key derived with HKDF from a master secret, the same inputs always derive the same key so nothing but the master needs to be kept")
+}
+
+type KeyArgs struct {
+	Master         string `pulumi:"master" provider:"secret"`
+	MasterEncoding string `pulumi:"masterEncoding,optional"`
+	Salt           string `pulumi:"salt,optional"`
+	Info           string `pulumi:"info,optional"`
+	Hash           string `pulumi:"hash,optional"`
+	Length         int    `pulumi:"length,optional"`
+	Format         string `pulumi:"format,optional"`
+}
+
+func (f *KeyArgs) Annotate(a infer.Annotator) {
+	a.Describe(&f.Master, "The master secret to derive the key from, e.g. the plaintext of an awskms.Random.")
+	a.Describe(&f.MasterEncoding, "How master is encoded. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&f.Salt, "Optional HKDF salt.")
+	a.Describe(&f.Info, "HKDF info, also known as label, derives a distinct key for each value from the same master.")
+	a.Describe(&f.Hash, "The hash function used by HKDF. SHA256 | SHA512. Default is SHA256.")
+	a.Describe(&f.Length, "Length of the derived key in bytes. Default is 32, which is also the only length of the age format.")
+	a.Describe(&f.Format, "How the derived key is encoded. base64 | hex | age. age returns an AGE-SECRET-KEY-1... X25519 identity along with its recipient. Default is base64.")
+}
+
+type KeyState struct {
+	KeyArgs
+	Key       string `pulumi:"key" provider:"secret"`
+	Recipient string `pulumi:"recipient,optional"`
+}
+
+func (f *KeyState) Annotate(a infer.Annotator) {
+	a.Describe(&f.Key, "The derived key in the requested format")
+	a.Describe(&f.Recipient, "The age recipient of the derived key, only set for the age format")
+}
+
+func (Key) Check(ctx context.Context, req infer.CheckRequest) (infer.CheckResponse[KeyArgs], error) {
+	args, failures, err := infer.DefaultCheck[KeyArgs](ctx, req.NewInputs)
+	if err != nil {
+		return infer.CheckResponse[KeyArgs]{}, err
+	}
+	failures = append(failures, Derivation{args.Master, args.MasterEncoding, args.Info, args.Salt, args.Hash}.Check("", req.NewInputs)...)
+	if check.Known(req.NewInputs, "format") {
+		failures = append(failures, check.Enum("format", args.Format, []string{FormatBase64, FormatHex, FormatAge})...)
+	}
+	if check.Known(req.NewInputs, "length") {
+		if args.Format == FormatAge && args.Length != 32 {
+			failures = append(failures, p.CheckFailure{Property: "length", Reason: "must be 32 for the age format"})
+		} else {
+			failures = append(failures, check.Range("length", args.Length, 1, 255*hashSize(args.Hash))...)
+		}
+	}
+	return infer.CheckResponse[KeyArgs]{Inputs: args, Failures: failures}, nil
+}
+
+func (Key) Create(ctx context.Context, req infer.CreateRequest[KeyArgs]) (resp infer.CreateResponse[KeyState], err error) {
+	if req.DryRun {
+		return
+	}
+	key, recipient, err := deriveKey(req.Inputs)
+	if err != nil {
+		return
+	}
+	return infer.CreateResponse[KeyState]{
+		ID: req.Name,
+		Output: KeyState{
+			req.Inputs,
+			key,
+			recipient,
+		},
+	}, nil
+}
+
+func (Key) Read(ctx context.Context, req infer.ReadRequest[KeyArgs, KeyState]) (resp infer.ReadResponse[KeyArgs, KeyState], err error) {
+	key, recipient, err := deriveKey(req.State.KeyArgs)
+	if err != nil {
+		return
+	}
+	state := req.State
+	if key != state.Key {
+		p.GetLogger(ctx).Warningf("key %s no longer matches its derivation inputs", req.ID)
+	}
+	state.Key, state.Recipient = key, recipient
+	return infer.ReadResponse[KeyArgs, KeyState]{
+		ID:     req.ID,
+		Inputs: req.Inputs,
+		State:  state,
+	}, nil
+}
+
+func (Key) Delete(ctx context.Context, req infer.DeleteRequest[KeyState]) (infer.DeleteResponse, error) {
+	return infer.DeleteResponse{}, nil
+}
+
+func (Key) Diff(ctx context.Context, req infer.DiffRequest[KeyArgs, KeyState]) (infer.DiffResponse, error) {
+	diff := map[string]p.PropertyDiff{}
+	if req.Inputs.Master != req.State.Master {
+		diff["master"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if masterEncodingOrDefault(req.Inputs.MasterEncoding) != masterEncodingOrDefault(req.State.MasterEncoding) {
+		diff["masterEncoding"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.Salt != req.State.Salt {
+		diff["salt"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if req.Inputs.Info != req.State.Info {
+		diff["info"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if hashOrDefault(req.Inputs.Hash) != hashOrDefault(req.State.Hash) {
+		diff["hash"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if lengthOrDefault(req.Inputs.Length) != lengthOrDefault(req.State.Length) {
+		diff["length"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if formatOrDefault(req.Inputs.Format) != formatOrDefault(req.State.Format) {
+		diff["format"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	return infer.DiffResponse{
+		DeleteBeforeReplace: false,
+		HasChanges:          len(diff) > 0,
+		DetailedDiff:        diff,
+	}, nil
+}
+
+func (Key) WireDependencies(f infer.FieldSelector, args *KeyArgs, state *KeyState) {
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Master))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.MasterEncoding))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Salt))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Info))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Hash))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Length))
+	f.OutputField(&state.Key).DependsOn(f.InputField(&args.Format))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Master))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.MasterEncoding))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Salt))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Info))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Hash))
+	f.OutputField(&state.Recipient).DependsOn(f.InputField(&args.Format))
+	f.OutputField(&state.Key).AlwaysSecret()
+	f.OutputField(&state.Recipient).NeverSecret()
+}
+
+// Derivation derives key material from a master secret and a label, for resources that
+// accept derived keys in place of random ones.
+type Derivation struct {
+	Master         string `pulumi:"master" provider:"secret"`
+	MasterEncoding string `pulumi:"masterEncoding,optional"`
+	Label          string `pulumi:"label"`
+	Salt           string `pulumi:"salt,optional"`
+	Hash           string `pulumi:"hash,optional"`
+}
+
+func (f *Derivation) Annotate(a infer.Annotator) {
+	a.Describe(&f.Master, "The master secret to derive from, e.g. the plaintext of an awskms.Random.")
+	a.Describe(&f.MasterEncoding, "How master is encoded. utf8 | base64 | hex. Default is utf8.")
+	a.Describe(&f.Label, "HKDF info, derives a distinct key for each label from the same master.")
+	a.Describe(&f.Salt, "Optional HKDF salt.")
+	a.Describe(&f.Hash, "The hash function used by HKDF. SHA256 | SHA512. Default is SHA256.")
+}
+
+// Check validates the master, masterEncoding and hash of the derivation in inputs, the
+// failures are reported under prefix, e.g. "derivation." when it is a nested input.
+func (d Derivation) Check(prefix string, inputs property.Map) (failures []p.CheckFailure) {
+	if check.Known(inputs, "master") {
+		if master, err := encoding.Decode(masterEncodingOrDefault(d.MasterEncoding), d.Master); err != nil {
+			failures = append(failures, p.CheckFailure{Property: prefix + "master", Reason: fmt.Sprintf("is not %s encoded", masterEncodingOrDefault(d.MasterEncoding))})
+		} else if len(master) == 0 {
+			failures = append(failures, p.CheckFailure{Property: prefix + "master", Reason: "must not be empty"})
+		}
+	}
+	if check.Known(inputs, "masterEncoding") {
+		failures = append(failures, check.Enum(prefix+"masterEncoding", d.MasterEncoding, []string{encoding.UTF8, encoding.Base64, encoding.Hex})...)
+	}
+	if check.Known(inputs, "hash") {
+		failures = append(failures, check.Enum(prefix+"hash", d.Hash, []string{HashSHA256, HashSHA512})...)
+	}
+	return failures
+}
+
+// Bytes derives length bytes from the derivation.
+func (d Derivation) Bytes(length int) ([]byte, error) {
+	master, err := encoding.Decode(masterEncodingOrDefault(d.MasterEncoding), d.Master)
+	if err != nil {
+		return nil, fmt.Errorf("master is not %s encoded", masterEncodingOrDefault(d.MasterEncoding))
+	}
+	return HKDF(d.Hash, master, []byte(d.Salt), d.Label, length)
+}
+
+// HKDF derives length bytes from master with salt and info, hash is SHA256 by default.
+func HKDF(hash string, master, salt []byte, info string, length int) ([]byte, error) {
+	if len(master) == 0 {
+		return nil, fmt.Errorf("master must not be empty")
+	}
+	switch hashOrDefault(hash) {
+	case HashSHA256:
+		return hkdf.Key(sha256.New, master, salt, info, length)
+	case HashSHA512:
+		return hkdf.Key(sha512.New, master, salt, info, length)
+	}
+	return nil, fmt.Errorf("unknown hash %s, must be one of SHA256, SHA512", hash)
+}
+
+// deriveKey derives the key described by args, returning it in the requested format and,
+// for the age format, its recipient.
+func deriveKey(args KeyArgs) (key string, recipient string, err error) {
+	b, err := Derivation{args.Master, args.MasterEncoding, args.Info, args.Salt, args.Hash}.Bytes(lengthOrDefault(args.Length))
+	if err != nil {
+		return "", "", err
+	}
+	switch formatOrDefault(args.Format) {
+	case FormatBase64:
+		return base64.StdEncoding.EncodeToString(b), "", nil
+	case FormatHex:
+		return hex.EncodeToString(b), "", nil
+	case FormatAge:
+		encoded, err := bech32.Encode("AGE-SECRET-KEY-", b)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to encode derived key to bech32")
+		}
+		identity, err := age.ParseX25519Identity(encoded)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to derive age identity: %s", err)
+		}
+		return identity.String(), identity.Recipient().String(), nil
+	}
+	return "", "", fmt.Errorf("unknown format %s, must be one of base64, hex, age", args.Format)
+}
+
+func masterEncodingOrDefault(s string) string {
+	if len(s) == 0 {
+		return encoding.UTF8
+	}
+	return s
+}
+
+func hashOrDefault(s string) string {
+	if len(s) == 0 {
+		return HashSHA256
+	}
+	return s
+}
+
+func formatOrDefault(s string) string {
+	if len(s) == 0 {
+		return FormatBase64
+	}
+	return s
+}
+
+func lengthOrDefault(n int) int {
+	if n == 0 {
+		return 32
+	}
+	return n
+}
+
+func hashSize(hash string) int {
+	if hashOrDefault(hash) == HashSHA512 {
+		return sha512.Size
+	}
+	return sha256.Size
+}
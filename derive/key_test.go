@@ -0,0 +1,84 @@
+package derive
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+// TestHKDF checks test case 1 of RFC 5869.
+func TestHKDF(t *testing.T) {
+	master, _ := hex.DecodeString(strings.Repeat("0b", 22))
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	key, err := HKDF(HashSHA256, master, salt, string(info), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key); got != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	master := "secret master key material"
+	tests := []struct {
+		name    string
+		args    KeyArgs
+		wantLen int
+		wantErr bool
+	}{
+		{name: "base64", args: KeyArgs{Master: master, Info: "app"}, wantLen: 44},
+		{name: "hex sha512", args: KeyArgs{Master: master, Info: "app", Hash: HashSHA512, Length: 64, Format: FormatHex}, wantLen: 128},
+		{name: "age", args: KeyArgs{Master: master, Info: "app", Format: FormatAge}, wantLen: 74},
+		{name: "base64 master", args: KeyArgs{Master: "c2VjcmV0IG1hc3RlciBrZXkgbWF0ZXJpYWw=", MasterEncoding: "base64", Info: "app"}, wantLen: 44},
+		{name: "base64 master not base64", args: KeyArgs{Master: "not base64!", MasterEncoding: "base64", Info: "app"}, wantErr: true},
+		{name: "empty master", args: KeyArgs{Master: "", Info: "app"}, wantErr: true},
+		{name: "unknown hash", args: KeyArgs{Master: master, Hash: "MD5"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := DeriveKey{}.Invoke(context.Background(), infer.FunctionRequest[KeyArgs]{Input: tt.args})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected derivation to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Output.Key) != tt.wantLen {
+				t.Fatalf("got key of length %d, want %d", len(resp.Output.Key), tt.wantLen)
+			}
+			if (tt.args.Format == FormatAge) != (len(resp.Output.Recipient) > 0) {
+				t.Fatalf("unexpected recipient %q", resp.Output.Recipient)
+			}
+			again, err := DeriveKey{}.Invoke(context.Background(), infer.FunctionRequest[KeyArgs]{Input: tt.args})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Output.Key != resp.Output.Key {
+				t.Fatal("expected derivation to be deterministic")
+			}
+		})
+	}
+
+	app := deriveKeyOrFail(t, KeyArgs{Master: master, Info: "app"})
+	db := deriveKeyOrFail(t, KeyArgs{Master: master, Info: "db"})
+	if app == db {
+		t.Fatal("expected distinct keys for distinct info")
+	}
+}
+
+func deriveKeyOrFail(t *testing.T, args KeyArgs) string {
+	t.Helper()
+	key, _, err := deriveKey(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,53 @@
+// Package check implements the input validation shared by the Check of every resource.
+package check
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+// Known reports whether key is set to a value known at check time, unknown values are
+// only validated once they resolve.
+func Known(inputs property.Map, key string) bool {
+	v, ok := inputs.GetOk(key)
+	return ok && !v.IsNull() && !v.IsComputed()
+}
+
+// Set reports whether key is given a value, known or not. An empty string is not a value,
+// it is what infer returns for an optional input that was never given, e.g. on import.
+func Set(inputs property.Map, key string) bool {
+	v, ok := inputs.GetOk(key)
+	return ok && !v.IsNull() && !(v.IsString() && len(v.AsString()) == 0)
+}
+
+// Range validates that n is between min and max inclusive.
+func Range(property string, n, min, max int) []p.CheckFailure {
+	if n < min || n > max {
+		return []p.CheckFailure{{Property: property, Reason: fmt.Sprintf("must be between %d and %d, got %d", min, max, n)}}
+	}
+	return nil
+}
+
+// Enum validates that v is one of values.
+func Enum[T ~string](property string, v T, values []T) []p.CheckFailure {
+	if slices.Contains(values, v) {
+		return nil
+	}
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = string(value)
+	}
+	return []p.CheckFailure{{Property: property, Reason: fmt.Sprintf("unknown value %q, must be one of %s", v, strings.Join(names, " | "))}}
+}
+
+// NotEmpty validates that s is set.
+func NotEmpty(property, s string) []p.CheckFailure {
+	if len(s) == 0 {
+		return []p.CheckFailure{{Property: property, Reason: "must not be empty"}}
+	}
+	return nil
+}
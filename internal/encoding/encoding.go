@@ -0,0 +1,44 @@
+// Package encoding converts between the string encodings accepted for binary inputs and outputs.
+package encoding
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	UTF8   = "utf8"
+	Base64 = "base64"
+	Hex    = "hex"
+)
+
+// Decode turns s given in encoding into raw bytes, utf8 is the default.
+func Decode(encoding, s string) ([]byte, error) {
+	switch encoding {
+	case "", UTF8:
+		return []byte(s), nil
+	case Base64:
+		return base64.StdEncoding.DecodeString(s)
+	case Hex:
+		return hex.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown encoding %s, must be one of utf8, base64, hex", encoding)
+}
+
+// Encode turns raw bytes into a string in encoding, utf8 is the default.
+func Encode(encoding string, b []byte) (string, error) {
+	switch encoding {
+	case "", UTF8:
+		if !utf8.Valid(b) {
+			return "", fmt.Errorf("result is not valid utf8, use base64 or hex encoding for binary data")
+		}
+		return string(b), nil
+	case Base64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case Hex:
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("unknown encoding %s, must be one of utf8, base64, hex", encoding)
+}
@@ -0,0 +1,50 @@
+// Package kmstest provides an in-memory KMS for testing the awskms resources offline.
+package kmstest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jcouyang/pulumi-keygen/internal/localkms"
+)
+
+// KMS is an in-memory KMS with the semantics of the local key store, master keys are
+// created on first use and can be put in any state to exercise failures.
+type KMS struct {
+	*localkms.Client
+
+	mu     sync.Mutex
+	states map[string]types.KeyState
+}
+
+func New() *KMS {
+	return &KMS{Client: localkms.New(), states: map[string]types.KeyState{}}
+}
+
+// SetKeyState changes the state DescribeKey reports for keyId.
+func (f *KMS) SetKeyState(keyId string, state types.KeyState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[keyId] = state
+}
+
+func (f *KMS) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	out, err := f.Client.DescribeKey(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if state, ok := f.states[aws.ToString(params.KeyId)]; ok {
+		out.KeyMetadata.KeyState = state
+		out.KeyMetadata.Enabled = state == types.KeyStateEnabled
+		if state == types.KeyStatePendingDeletion {
+			out.KeyMetadata.DeletionDate = aws.Time(time.Now().AddDate(0, 0, 7))
+		}
+	}
+	return out, nil
+}
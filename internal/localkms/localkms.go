@@ -0,0 +1,435 @@
+// Package localkms implements the subset of the AWS KMS API used by the awskms resources
+// on top of master keys kept in a local file, for offline development and tests.
+//
+// Master keys are created on first use of a key ID and stored as 256-bit AES keys. Like KMS,
+// ciphertext blobs carry the ID of the key that encrypted them and are bound to the
+// encryption context, so Decrypt needs neither the key ID nor anything but the blob.
+//
+// A key ID also signs with an asymmetric key pair, created on first use with the key spec
+// the signing algorithm implies, e.g. ECC_NIST_P256 for ECDSA_SHA_256 and RSA_2048 for
+// every RSA algorithm. Like KMS, the key then only signs with the algorithms of that key
+// spec. HMAC keys are derived from the master key with HKDF, one for each MAC algorithm.
+package localkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// blobVersion prefixes every ciphertext blob so the format can evolve.
+const blobVersion = 1
+
+// Client is a local KMS backed by the master keys in a file.
+type Client struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]masterKey
+}
+
+type masterKey struct {
+	Material     []byte    `json:"material"`
+	CreationDate time.Time `json:"creationDate"`
+	// KeyPair is the asymmetric key pair the key signs with, if it has signed anything.
+	KeyPair *keyPair `json:"keyPair,omitempty"`
+}
+
+type keyPair struct {
+	Spec       types.DataKeyPairSpec `json:"spec"`
+	PrivateKey []byte                `json:"privateKey"`
+}
+
+type keyStore struct {
+	Keys map[string]masterKey `json:"keys"`
+}
+
+// New returns a local KMS whose master keys only live in memory.
+func New() *Client {
+	return &Client{keys: map[string]masterKey{}}
+}
+
+// Open loads the master keys in path, the file is created once the first key is.
+func Open(path string) (*Client, error) {
+	c := &Client{path: path, keys: map[string]masterKey{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local key store %s: %w", path, err)
+	}
+	var store keyStore
+	if err := json.Unmarshal(b, &store); err != nil {
+		return nil, fmt.Errorf("local key store %s is malformed: %w", path, err)
+	}
+	for id, key := range store.Keys {
+		c.keys[id] = key
+	}
+	return c, nil
+}
+
+// key returns the master key of id, creating and persisting it when create is set.
+func (c *Client) key(id string, create bool) (masterKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[id]; ok {
+		return key, nil
+	}
+	if !create {
+		return masterKey{}, &types.NotFoundException{Message: aws.String(fmt.Sprintf("key %s does not exist in the local key store", id))}
+	}
+	key := masterKey{Material: make([]byte, 32), CreationDate: time.Now().UTC()}
+	if _, err := rand.Read(key.Material); err != nil {
+		return masterKey{}, err
+	}
+	c.keys[id] = key
+	if err := c.save(); err != nil {
+		delete(c.keys, id)
+		return masterKey{}, err
+	}
+	return key, nil
+}
+
+func (c *Client) save() error {
+	if len(c.path) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(keyStore{Keys: c.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create local key store %s: %w", c.path, err)
+		}
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write local key store %s: %w", c.path, err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// seal encrypts plaintext under the master key of keyId into a ciphertext blob laid out as
+// version | key id length | key id | nonce | AES-GCM sealed plaintext.
+func (c *Client) seal(keyId string, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	if len(keyId) == 0 {
+		return nil, fmt.Errorf("keyId is required")
+	}
+	key, err := c.key(keyId, true)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := binary.BigEndian.AppendUint16([]byte{blobVersion}, uint16(len(keyId)))
+	header = append(header, keyId...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ad, err := additionalData(keyId, encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	blob := append(header, nonce...)
+	return aead.Seal(blob, nonce, plaintext, ad), nil
+}
+
+// open decrypts a ciphertext blob made by seal, returning the ID of the key it was sealed with.
+func (c *Client) open(blob []byte, encryptionContext map[string]string) (string, []byte, error) {
+	invalid := &types.InvalidCiphertextException{Message: aws.String("ciphertext blob is not valid for the local key store")}
+	if len(blob) < 3 || blob[0] != blobVersion {
+		return "", nil, invalid
+	}
+	n := int(binary.BigEndian.Uint16(blob[1:3]))
+	if len(blob) < 3+n {
+		return "", nil, invalid
+	}
+	keyId, rest := string(blob[3:3+n]), blob[3+n:]
+	key, err := c.key(keyId, false)
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return "", nil, invalid
+	}
+	ad, err := additionalData(keyId, encryptionContext)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], ad)
+	if err != nil {
+		return "", nil, invalid
+	}
+	return keyId, plaintext, nil
+}
+
+func newAEAD(key masterKey) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.Material)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds a blob to its key and encryption context, json sorts the context keys.
+func additionalData(keyId string, encryptionContext map[string]string) ([]byte, error) {
+	if len(encryptionContext) == 0 {
+		// like KMS, an empty context is the same as none
+		encryptionContext = nil
+	}
+	ctx, err := json.Marshal(encryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(keyId+"\x00"), ctx...), nil
+}
+
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+func dryRun(dryRun *bool) error {
+	if aws.ToBool(dryRun) {
+		return &types.DryRunOperationException{Message: aws.String("the request would have succeeded")}
+	}
+	return nil
+}
+
+func (c *Client) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	keyId := aws.ToString(params.KeyId)
+	key, err := c.key(keyId, false)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &types.KeyMetadata{
+		KeyId:        aws.String(keyId),
+		CreationDate: aws.Time(key.CreationDate),
+		Enabled:      true,
+		KeyState:     types.KeyStateEnabled,
+		KeyUsage:     types.KeyUsageTypeEncryptDecrypt,
+		KeySpec:      types.KeySpecSymmetricDefault,
+	}
+	if key.KeyPair != nil {
+		metadata.KeyUsage = types.KeyUsageTypeSignVerify
+		metadata.KeySpec = types.KeySpec(key.KeyPair.Spec)
+		metadata.SigningAlgorithms = key.KeyPair.signingAlgorithms()
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: metadata}, nil
+}
+
+func (c *Client) GenerateRandom(ctx context.Context, params *kms.GenerateRandomInput, optFns ...func(*kms.Options)) (*kms.GenerateRandomOutput, error) {
+	n := int(aws.ToInt32(params.NumberOfBytes))
+	if n < 1 || n > 1024 {
+		return nil, fmt.Errorf("numberOfBytes must be between 1 and 1024, got %d", n)
+	}
+	b, err := random(n)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateRandomOutput{Plaintext: b}, nil
+}
+
+func (c *Client) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	n, err := dataKeySize(params.KeySpec, params.NumberOfBytes)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := random(n)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.seal(aws.ToString(params.KeyId), plaintext, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{KeyId: params.KeyId, Plaintext: plaintext, CiphertextBlob: blob}, nil
+}
+
+func (c *Client) GenerateDataKeyWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyWithoutPlaintextOutput, error) {
+	out, err := c.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             params.KeyId,
+		KeySpec:           params.KeySpec,
+		NumberOfBytes:     params.NumberOfBytes,
+		EncryptionContext: params.EncryptionContext,
+		DryRun:            params.DryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyWithoutPlaintextOutput{KeyId: out.KeyId, CiphertextBlob: out.CiphertextBlob}, nil
+}
+
+func dataKeySize(spec types.DataKeySpec, numberOfBytes *int32) (int, error) {
+	switch {
+	case len(spec) > 0 && numberOfBytes != nil:
+		return 0, fmt.Errorf("only one of keySpec and numberOfBytes can be provided")
+	case spec == types.DataKeySpecAes128:
+		return 16, nil
+	case spec == types.DataKeySpecAes256:
+		return 32, nil
+	case len(spec) > 0:
+		return 0, fmt.Errorf("unknown keySpec %s", spec)
+	case numberOfBytes == nil:
+		return 0, fmt.Errorf("one of keySpec and numberOfBytes is required")
+	}
+	if n := int(*numberOfBytes); n >= 1 && n <= 1024 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("numberOfBytes must be between 1 and 1024, got %d", *numberOfBytes)
+}
+
+func (c *Client) GenerateDataKeyPair(ctx context.Context, params *kms.GenerateDataKeyPairInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	private, public, err := generateKeyPair(params.KeyPairSpec)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.seal(aws.ToString(params.KeyId), private, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyPairOutput{
+		KeyId:                    params.KeyId,
+		KeyPairSpec:              params.KeyPairSpec,
+		PrivateKeyPlaintext:      private,
+		PrivateKeyCiphertextBlob: blob,
+		PublicKey:                public,
+	}, nil
+}
+
+func (c *Client) GenerateDataKeyPairWithoutPlaintext(ctx context.Context, params *kms.GenerateDataKeyPairWithoutPlaintextInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyPairWithoutPlaintextOutput, error) {
+	out, err := c.GenerateDataKeyPair(ctx, &kms.GenerateDataKeyPairInput{
+		KeyId:             params.KeyId,
+		KeyPairSpec:       params.KeyPairSpec,
+		EncryptionContext: params.EncryptionContext,
+		DryRun:            params.DryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyPairWithoutPlaintextOutput{
+		KeyId:                    out.KeyId,
+		KeyPairSpec:              out.KeyPairSpec,
+		PrivateKeyCiphertextBlob: out.PrivateKeyCiphertextBlob,
+		PublicKey:                out.PublicKey,
+	}, nil
+}
+
+// generateKeyPair returns a PKCS#8 private key and a PKIX public key, the DER encodings
+// KMS returns for data key pairs.
+func generateKeyPair(spec types.DataKeyPairSpec) (private, public []byte, err error) {
+	var key crypto.Signer
+	switch spec {
+	case types.DataKeyPairSpecRsa2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case types.DataKeyPairSpecRsa3072:
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	case types.DataKeyPairSpecRsa4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	case types.DataKeyPairSpecEccNistP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case types.DataKeyPairSpecEccNistP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case types.DataKeyPairSpecEccNistP521:
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("keyPairSpec %s is not supported by the local key store", spec))}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if private, err = x509.MarshalPKCS8PrivateKey(key); err != nil {
+		return nil, nil, err
+	}
+	if public, err = x509.MarshalPKIXPublicKey(key.Public()); err != nil {
+		return nil, nil, err
+	}
+	return private, public, nil
+}
+
+func (c *Client) Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	if len(params.Plaintext) > 4096 {
+		return nil, fmt.Errorf("plaintext must be at most 4096 bytes, got %d", len(params.Plaintext))
+	}
+	blob, err := c.seal(aws.ToString(params.KeyId), params.Plaintext, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{KeyId: params.KeyId, CiphertextBlob: blob, EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault}, nil
+}
+
+func (c *Client) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	keyId, plaintext, err := c.open(params.CiphertextBlob, params.EncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	if want := aws.ToString(params.KeyId); len(want) > 0 && want != keyId {
+		return nil, &types.IncorrectKeyException{Message: aws.String(fmt.Sprintf("ciphertext blob was encrypted with key %s, not %s", keyId, want))}
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(keyId), Plaintext: plaintext, EncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault}, nil
+}
+
+func (c *Client) ReEncrypt(ctx context.Context, params *kms.ReEncryptInput, optFns ...func(*kms.Options)) (*kms.ReEncryptOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	sourceKeyId, plaintext, err := c.open(params.CiphertextBlob, params.SourceEncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	if want := aws.ToString(params.SourceKeyId); len(want) > 0 && want != sourceKeyId {
+		return nil, &types.IncorrectKeyException{Message: aws.String(fmt.Sprintf("ciphertext blob was encrypted with key %s, not %s", sourceKeyId, want))}
+	}
+	blob, err := c.seal(aws.ToString(params.DestinationKeyId), plaintext, params.DestinationEncryptionContext)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.ReEncryptOutput{
+		CiphertextBlob:                 blob,
+		KeyId:                          params.DestinationKeyId,
+		SourceKeyId:                    aws.String(sourceKeyId),
+		SourceEncryptionAlgorithm:      types.EncryptionAlgorithmSpecSymmetricDefault,
+		DestinationEncryptionAlgorithm: types.EncryptionAlgorithmSpecSymmetricDefault,
+	}, nil
+}
@@ -0,0 +1,201 @@
+package localkms
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func open(t *testing.T, path string) *Client {
+	t.Helper()
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	c := open(t, path)
+	enc, err := c.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String("alias/app"),
+		Plaintext:         []byte("hello"),
+		EncryptionContext: map[string]string{"stack": "dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new client on the same file decrypts without being told the key
+	dec, err := open(t, path).Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    enc.CiphertextBlob,
+		EncryptionContext: map[string]string{"stack": "dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.Plaintext, []byte("hello")) || aws.ToString(dec.KeyId) != "alias/app" {
+		t.Fatalf("unexpected decrypt output %q with key %s", dec.Plaintext, aws.ToString(dec.KeyId))
+	}
+
+	var invalid *types.InvalidCiphertextException
+	_, err = c.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: map[string]string{"stack": "prod"}})
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a wrong encryption context to fail with InvalidCiphertextException, got %v", err)
+	}
+	var incorrect *types.IncorrectKeyException
+	_, err = c.Decrypt(ctx, &kms.DecryptInput{KeyId: aws.String("alias/other"), CiphertextBlob: enc.CiphertextBlob, EncryptionContext: map[string]string{"stack": "dev"}})
+	if !errors.As(err, &incorrect) {
+		t.Fatalf("expected a wrong key to fail with IncorrectKeyException, got %v", err)
+	}
+	var notFound *types.NotFoundException
+	_, err = open(t, filepath.Join(t.TempDir(), "other.json")).Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: map[string]string{"stack": "dev"}})
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected another key store to fail with NotFoundException, got %v", err)
+	}
+}
+
+func TestGenerateDataKey(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	tests := []struct {
+		name    string
+		input   kms.GenerateDataKeyInput
+		size    int
+		wantErr bool
+	}{
+		{name: "aes 256", input: kms.GenerateDataKeyInput{KeySpec: types.DataKeySpecAes256}, size: 32},
+		{name: "aes 128", input: kms.GenerateDataKeyInput{KeySpec: types.DataKeySpecAes128}, size: 16},
+		{name: "number of bytes", input: kms.GenerateDataKeyInput{NumberOfBytes: aws.Int32(64)}, size: 64},
+		{name: "both", input: kms.GenerateDataKeyInput{KeySpec: types.DataKeySpecAes256, NumberOfBytes: aws.Int32(64)}, wantErr: true},
+		{name: "neither", input: kms.GenerateDataKeyInput{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.KeyId = aws.String("alias/app")
+			out, err := c.GenerateDataKey(ctx, &tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected GenerateDataKey to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out.Plaintext) != tt.size {
+				t.Fatalf("got %d bytes, want %d", len(out.Plaintext), tt.size)
+			}
+			dec, err := c.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: out.CiphertextBlob})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dec.Plaintext, out.Plaintext) {
+				t.Fatal("ciphertext blob does not decrypt to the plaintext")
+			}
+		})
+	}
+}
+
+func TestGenerateDataKeyPair(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	for _, spec := range []types.DataKeyPairSpec{types.DataKeyPairSpecRsa2048, types.DataKeyPairSpecEccNistP256, types.DataKeyPairSpecEccNistP521} {
+		t.Run(string(spec), func(t *testing.T) {
+			out, err := c.GenerateDataKeyPair(ctx, &kms.GenerateDataKeyPairInput{KeyId: aws.String("alias/app"), KeyPairSpec: spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := x509.ParsePKCS8PrivateKey(out.PrivateKeyPlaintext); err != nil {
+				t.Fatalf("private key is not PKCS#8: %s", err)
+			}
+			if _, err := x509.ParsePKIXPublicKey(out.PublicKey); err != nil {
+				t.Fatalf("public key is not PKIX: %s", err)
+			}
+		})
+	}
+	var unsupported *types.UnsupportedOperationException
+	_, err := c.GenerateDataKeyPair(ctx, &kms.GenerateDataKeyPairInput{KeyId: aws.String("alias/app"), KeyPairSpec: types.DataKeyPairSpecSm2})
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected SM2 to be unsupported, got %v", err)
+	}
+}
+
+func TestDescribeKey(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	var notFound *types.NotFoundException
+	if _, err := c.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/app")}); !errors.As(err, &notFound) {
+		t.Fatalf("expected unknown key to be not found, got %v", err)
+	}
+	if _, err := c.GenerateRandom(ctx, &kms.GenerateRandomInput{NumberOfBytes: aws.Int32(16)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String("alias/app"), Plaintext: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/app")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.KeyMetadata.KeyState != types.KeyStateEnabled {
+		t.Fatalf("unexpected key state %s", out.KeyMetadata.KeyState)
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	enc, err := c.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:             aws.String("alias/old"),
+		Plaintext:         []byte("hello"),
+		EncryptionContext: map[string]string{"stack": "dev"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.ReEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:               enc.CiphertextBlob,
+		SourceEncryptionContext:      map[string]string{"stack": "dev"},
+		DestinationKeyId:             aws.String("alias/new"),
+		DestinationEncryptionContext: map[string]string{"stack": "prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(out.SourceKeyId) != "alias/old" {
+		t.Fatalf("unexpected source key %s", aws.ToString(out.SourceKeyId))
+	}
+	dec, err := c.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: out.CiphertextBlob, EncryptionContext: map[string]string{"stack": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.Plaintext, []byte("hello")) || aws.ToString(dec.KeyId) != "alias/new" {
+		t.Fatalf("unexpected decrypt output %q with key %s", dec.Plaintext, aws.ToString(dec.KeyId))
+	}
+
+	var invalid *types.InvalidCiphertextException
+	_, err = c.ReEncrypt(ctx, &kms.ReEncryptInput{CiphertextBlob: enc.CiphertextBlob, DestinationKeyId: aws.String("alias/new")})
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a missing source encryption context to fail with InvalidCiphertextException, got %v", err)
+	}
+	var incorrect *types.IncorrectKeyException
+	_, err = c.ReEncrypt(ctx, &kms.ReEncryptInput{
+		CiphertextBlob:          enc.CiphertextBlob,
+		SourceKeyId:             aws.String("alias/other"),
+		SourceEncryptionContext: map[string]string{"stack": "dev"},
+		DestinationKeyId:        aws.String("alias/new"),
+	})
+	if !errors.As(err, &incorrect) {
+		t.Fatalf("expected a wrong source key to fail with IncorrectKeyException, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package localkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+var macAlgorithms = map[types.MacAlgorithmSpec]crypto.Hash{
+	types.MacAlgorithmSpecHmacSha224: crypto.SHA224,
+	types.MacAlgorithmSpecHmacSha256: crypto.SHA256,
+	types.MacAlgorithmSpecHmacSha384: crypto.SHA384,
+	types.MacAlgorithmSpecHmacSha512: crypto.SHA512,
+}
+
+// mac computes the HMAC of message with a key derived from the master key of keyId, so
+// HMAC and encryption never share key material.
+func (c *Client) mac(keyId string, algorithm types.MacAlgorithmSpec, message []byte, create bool) ([]byte, error) {
+	hash, ok := macAlgorithms[algorithm]
+	if !ok {
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("mac algorithm %s is not supported by the local key store", algorithm))}
+	}
+	if len(message) > 4096 {
+		return nil, fmt.Errorf("message must be at most 4096 bytes, got %d", len(message))
+	}
+	key, err := c.key(keyId, create)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := hkdf.Key(sha256.New, key.Material, nil, "localkms "+string(algorithm), hash.Size())
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(hash.New, macKey)
+	h.Write(message)
+	return h.Sum(nil), nil
+}
+
+func (c *Client) GenerateMac(ctx context.Context, params *kms.GenerateMacInput, optFns ...func(*kms.Options)) (*kms.GenerateMacOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	mac, err := c.mac(aws.ToString(params.KeyId), params.MacAlgorithm, params.Message, true)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateMacOutput{KeyId: params.KeyId, Mac: mac, MacAlgorithm: params.MacAlgorithm}, nil
+}
+
+func (c *Client) VerifyMac(ctx context.Context, params *kms.VerifyMacInput, optFns ...func(*kms.Options)) (*kms.VerifyMacOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	mac, err := c.mac(aws.ToString(params.KeyId), params.MacAlgorithm, params.Message, false)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, params.Mac) {
+		return nil, &types.KMSInvalidMacException{Message: aws.String("mac is not valid")}
+	}
+	return &kms.VerifyMacOutput{KeyId: params.KeyId, MacAlgorithm: params.MacAlgorithm, MacValid: true}, nil
+}
@@ -0,0 +1,61 @@
+package localkms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func TestGenerateVerifyMac(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	c := open(t, path)
+	for algorithm, hash := range macAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			out, err := c.GenerateMac(ctx, &kms.GenerateMacInput{KeyId: aws.String("alias/hmac"), Message: []byte("payload"), MacAlgorithm: algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(out.Mac) != hash.Size() {
+				t.Fatalf("got a %d byte mac, want %d", len(out.Mac), hash.Size())
+			}
+			// HMAC is deterministic, the same key gives the same mac after a reopen
+			again, err := open(t, path).GenerateMac(ctx, &kms.GenerateMacInput{KeyId: aws.String("alias/hmac"), Message: []byte("payload"), MacAlgorithm: algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again.Mac, out.Mac) {
+				t.Fatal("expected the persisted key to compute the same mac")
+			}
+			mac := bytes.Clone(out.Mac)
+			mac[0] ^= 1
+			var invalid *types.KMSInvalidMacException
+			if _, err := c.VerifyMac(ctx, &kms.VerifyMacInput{KeyId: aws.String("alias/hmac"), Message: []byte("payload"), Mac: mac, MacAlgorithm: algorithm}); !errors.As(err, &invalid) {
+				t.Fatalf("expected a modified mac to fail with KMSInvalidMacException, got %v", err)
+			}
+		})
+	}
+
+	sha256, err := c.GenerateMac(ctx, &kms.GenerateMacInput{KeyId: aws.String("alias/hmac"), Message: []byte("payload"), MacAlgorithm: types.MacAlgorithmSpecHmacSha256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := c.GenerateMac(ctx, &kms.GenerateMacInput{KeyId: aws.String("alias/other"), Message: []byte("payload"), MacAlgorithm: types.MacAlgorithmSpecHmacSha256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sha256.Mac, other.Mac) {
+		t.Fatal("expected distinct keys to compute distinct macs")
+	}
+
+	var notFound *types.NotFoundException
+	if _, err := c.VerifyMac(ctx, &kms.VerifyMacInput{KeyId: aws.String("alias/missing"), Message: []byte("payload"), Mac: []byte("mac"), MacAlgorithm: types.MacAlgorithmSpecHmacSha256}); !errors.As(err, &notFound) {
+		t.Fatalf("expected verify with an unknown key to fail with NotFoundException, got %v", err)
+	}
+}
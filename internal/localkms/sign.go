@@ -0,0 +1,200 @@
+package localkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// signingAlgorithm is what a KMS signing algorithm means for the local key store.
+type signingAlgorithm struct {
+	spec types.DataKeyPairSpec
+	hash crypto.Hash
+	pss  bool
+}
+
+var signingAlgorithms = map[types.SigningAlgorithmSpec]signingAlgorithm{
+	types.SigningAlgorithmSpecRsassaPssSha256:      {types.DataKeyPairSpecRsa2048, crypto.SHA256, true},
+	types.SigningAlgorithmSpecRsassaPssSha384:      {types.DataKeyPairSpecRsa2048, crypto.SHA384, true},
+	types.SigningAlgorithmSpecRsassaPssSha512:      {types.DataKeyPairSpecRsa2048, crypto.SHA512, true},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha256: {types.DataKeyPairSpecRsa2048, crypto.SHA256, false},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha384: {types.DataKeyPairSpecRsa2048, crypto.SHA384, false},
+	types.SigningAlgorithmSpecRsassaPkcs1V15Sha512: {types.DataKeyPairSpecRsa2048, crypto.SHA512, false},
+	types.SigningAlgorithmSpecEcdsaSha256:          {types.DataKeyPairSpecEccNistP256, crypto.SHA256, false},
+	types.SigningAlgorithmSpecEcdsaSha384:          {types.DataKeyPairSpecEccNistP384, crypto.SHA384, false},
+	types.SigningAlgorithmSpecEcdsaSha512:          {types.DataKeyPairSpecEccNistP521, crypto.SHA512, false},
+}
+
+func lookupSigningAlgorithm(spec types.SigningAlgorithmSpec) (signingAlgorithm, error) {
+	if algorithm, ok := signingAlgorithms[spec]; ok {
+		return algorithm, nil
+	}
+	return signingAlgorithm{}, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("signing algorithm %s is not supported by the local key store", spec))}
+}
+
+// digest returns what is signed for message, hashing it unless it already is a digest.
+func (a signingAlgorithm) digest(message []byte, messageType types.MessageType) ([]byte, error) {
+	switch messageType {
+	case "", types.MessageTypeRaw:
+		if len(message) > 4096 {
+			return nil, fmt.Errorf("message must be at most 4096 bytes, got %d", len(message))
+		}
+		h := a.hash.New()
+		h.Write(message)
+		return h.Sum(nil), nil
+	case types.MessageTypeDigest:
+		if len(message) != a.hash.Size() {
+			return nil, fmt.Errorf("digest must be %d bytes for %s, got %d", a.hash.Size(), a.hash, len(message))
+		}
+		return message, nil
+	}
+	return nil, fmt.Errorf("unknown message type %s", messageType)
+}
+
+func (a signingAlgorithm) opts() crypto.SignerOpts {
+	if a.pss {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: a.hash}
+	}
+	return a.hash
+}
+
+// keyPair returns the private key of keyId for spec, creating and persisting it when
+// create is set and the key has no key pair yet.
+func (c *Client) keyPair(keyId string, spec types.DataKeyPairSpec, create bool) (crypto.Signer, error) {
+	if _, err := c.key(keyId, create); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.keys[keyId]
+	if key.KeyPair == nil {
+		if !create {
+			return nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("key %s has not signed anything in the local key store", keyId))}
+		}
+		private, _, err := generateKeyPair(spec)
+		if err != nil {
+			return nil, err
+		}
+		key.KeyPair = &keyPair{Spec: spec, PrivateKey: private}
+		c.keys[keyId] = key
+		if err := c.save(); err != nil {
+			key.KeyPair = nil
+			c.keys[keyId] = key
+			return nil, err
+		}
+	}
+	if key.KeyPair.Spec != spec {
+		return nil, &types.InvalidKeyUsageException{Message: aws.String(fmt.Sprintf("key %s is a %s key, it only signs with %v", keyId, key.KeyPair.Spec, key.KeyPair.signingAlgorithms()))}
+	}
+	return key.KeyPair.signer()
+}
+
+func (k *keyPair) signer() (crypto.Signer, error) {
+	private, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s key pair is malformed: %w", k.Spec, err)
+	}
+	return private.(crypto.Signer), nil
+}
+
+// signingAlgorithms returns the algorithms the key pair signs with, sorted like KMS lists them.
+func (k *keyPair) signingAlgorithms() []types.SigningAlgorithmSpec {
+	var algorithms []types.SigningAlgorithmSpec
+	for _, algorithm := range types.SigningAlgorithmSpec("").Values() {
+		if a, ok := signingAlgorithms[algorithm]; ok && a.spec == k.Spec {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms
+}
+
+func (c *Client) Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	algorithm, err := lookupSigningAlgorithm(params.SigningAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := algorithm.digest(params.Message, params.MessageType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.keyPair(aws.ToString(params.KeyId), algorithm.spec, true)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := key.Sign(rand.Reader, digest, algorithm.opts())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.SignOutput{KeyId: params.KeyId, Signature: signature, SigningAlgorithm: params.SigningAlgorithm}, nil
+}
+
+func (c *Client) Verify(ctx context.Context, params *kms.VerifyInput, optFns ...func(*kms.Options)) (*kms.VerifyOutput, error) {
+	if err := dryRun(params.DryRun); err != nil {
+		return nil, err
+	}
+	algorithm, err := lookupSigningAlgorithm(params.SigningAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := algorithm.digest(params.Message, params.MessageType)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.keyPair(aws.ToString(params.KeyId), algorithm.spec, false)
+	if err != nil {
+		return nil, err
+	}
+	var valid bool
+	switch public := key.Public().(type) {
+	case *rsa.PublicKey:
+		if algorithm.pss {
+			valid = rsa.VerifyPSS(public, algorithm.hash, digest, params.Signature, algorithm.opts().(*rsa.PSSOptions)) == nil
+		} else {
+			valid = rsa.VerifyPKCS1v15(public, algorithm.hash, digest, params.Signature) == nil
+		}
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(public, digest, params.Signature)
+	}
+	if !valid {
+		// like KMS, an invalid signature is an error rather than SignatureValid false
+		return nil, &types.KMSInvalidSignatureException{Message: aws.String("signature is not valid")}
+	}
+	return &kms.VerifyOutput{KeyId: params.KeyId, SignatureValid: true, SigningAlgorithm: params.SigningAlgorithm}, nil
+}
+
+func (c *Client) GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	keyId := aws.ToString(params.KeyId)
+	key, err := c.key(keyId, false)
+	if err != nil {
+		return nil, err
+	}
+	if key.KeyPair == nil {
+		return nil, &types.UnsupportedOperationException{Message: aws.String(fmt.Sprintf("key %s is symmetric, the local key store only creates its key pair when it first signs", keyId))}
+	}
+	private, err := key.KeyPair.signer()
+	if err != nil {
+		return nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GetPublicKeyOutput{
+		KeyId:             params.KeyId,
+		PublicKey:         public,
+		KeySpec:           types.KeySpec(key.KeyPair.Spec),
+		KeyUsage:          types.KeyUsageTypeSignVerify,
+		SigningAlgorithms: key.KeyPair.signingAlgorithms(),
+	}, nil
+}
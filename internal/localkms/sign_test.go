@@ -0,0 +1,127 @@
+package localkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func TestSignVerify(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	c := open(t, path)
+	for algorithm := range signingAlgorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			keyId := aws.String("alias/" + string(algorithm))
+			out, err := c.Sign(ctx, &kms.SignInput{KeyId: keyId, Message: []byte("manifest"), SigningAlgorithm: algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a new client on the same file verifies with the same key pair
+			verify := &kms.VerifyInput{KeyId: keyId, Message: []byte("manifest"), Signature: out.Signature, SigningAlgorithm: algorithm}
+			if _, err := open(t, path).Verify(ctx, verify); err != nil {
+				t.Fatalf("expected the signature to verify, got %v", err)
+			}
+			var invalid *types.KMSInvalidSignatureException
+			verify.Message = []byte("tampered")
+			if _, err := c.Verify(ctx, verify); !errors.As(err, &invalid) {
+				t.Fatalf("expected a tampered message to fail with KMSInvalidSignatureException, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignDigest(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	digest := sha512.Sum384([]byte("manifest"))
+	out, err := c.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String("alias/signer"),
+		Message:          digest[:],
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha384,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// signing the digest is the same as signing the message
+	if _, err := c.Verify(ctx, &kms.VerifyInput{
+		KeyId:            aws.String("alias/signer"),
+		Message:          []byte("manifest"),
+		Signature:        out.Signature,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha384,
+	}); err != nil {
+		t.Fatalf("expected the digest signature to verify the message, got %v", err)
+	}
+
+	if _, err := c.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String("alias/signer"),
+		Message:          digest[:32],
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha384,
+	}); err == nil {
+		t.Fatal("expected a digest of the wrong size to fail")
+	}
+	var unsupported *types.UnsupportedOperationException
+	if _, err := c.Sign(ctx, &kms.SignInput{KeyId: aws.String("alias/signer"), Message: []byte("manifest"), SigningAlgorithm: types.SigningAlgorithmSpecSm2dsa}); !errors.As(err, &unsupported) {
+		t.Fatalf("expected SM2DSA to be unsupported, got %v", err)
+	}
+	var notFound *types.NotFoundException
+	if _, err := c.Verify(ctx, &kms.VerifyInput{KeyId: aws.String("alias/other"), Message: []byte("manifest"), Signature: out.Signature, SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha384}); !errors.As(err, &notFound) {
+		t.Fatalf("expected verify with an unknown key to fail with NotFoundException, got %v", err)
+	}
+}
+
+func TestSigningKeySpec(t *testing.T) {
+	ctx := context.Background()
+	c := open(t, filepath.Join(t.TempDir(), "keys.json"))
+	var unsupported *types.UnsupportedOperationException
+	if _, err := c.Encrypt(ctx, &kms.EncryptInput{KeyId: aws.String("alias/signer"), Plaintext: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/signer")}); !errors.As(err, &unsupported) {
+		t.Fatalf("expected the public key of a symmetric key to be unsupported, got %v", err)
+	}
+
+	out, err := c.Sign(ctx, &kms.SignInput{KeyId: aws.String("alias/signer"), Message: []byte("manifest"), SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := c.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String("alias/signer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.KeySpec != types.KeySpecEccNistP256 || public.KeyUsage != types.KeyUsageTypeSignVerify {
+		t.Fatalf("unexpected key spec %s and usage %s", public.KeySpec, public.KeyUsage)
+	}
+	key, err := x509.ParsePKIXPublicKey(public.PublicKey)
+	if err != nil {
+		t.Fatalf("public key is not PKIX: %s", err)
+	}
+	digest := sha256.Sum256([]byte("manifest"))
+	if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], out.Signature) {
+		t.Fatal("expected the public key to verify the signature")
+	}
+
+	described, err := c.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String("alias/signer")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if described.KeyMetadata.KeySpec != types.KeySpecEccNistP256 || described.KeyMetadata.KeyUsage != types.KeyUsageTypeSignVerify {
+		t.Fatalf("expected DescribeKey to report the key pair, got %s %s", described.KeyMetadata.KeySpec, described.KeyMetadata.KeyUsage)
+	}
+
+	var usage *types.InvalidKeyUsageException
+	if _, err := c.Sign(ctx, &kms.SignInput{KeyId: aws.String("alias/signer"), Message: []byte("manifest"), SigningAlgorithm: types.SigningAlgorithmSpecRsassaPssSha256}); !errors.As(err, &usage) {
+		t.Fatalf("expected an algorithm of another key spec to fail with InvalidKeyUsageException, got %v", err)
+	}
+}
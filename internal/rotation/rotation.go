@@ -0,0 +1,189 @@
+// Package rotation implements the expiry and renewal logic shared by every key resource.
+package rotation
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/infer"
+)
+
+type clockKey struct{}
+
+// WithClock returns a context in which keys are rotated at the time now returns instead
+// of the wall clock, e.g. for tests that move a key past its expiry.
+func WithClock(ctx context.Context, now func() time.Time) context.Context {
+	return context.WithValue(ctx, clockKey{}, now)
+}
+
+// Now returns the time to decide whether a key is due for renewal at, the clock of ctx
+// if it has one.
+func Now(ctx context.Context) time.Time {
+	if now, ok := ctx.Value(clockKey{}).(func() time.Time); ok {
+		return now()
+	}
+	return time.Now()
+}
+
+// Args are the rotation inputs embedded in the args of every key resource.
+type Args struct {
+	ValidityPeriodHours int               `pulumi:"validityPeriodHours,optional"`
+	EarlyRenewalHours   int               `pulumi:"earlyRenewalHours,optional"`
+	Triggers            map[string]string `pulumi:"triggers,optional"`
+	RotationSchedule    string            `pulumi:"rotationSchedule,optional"`
+}
+
+func (f *Args) Annotate(a infer.Annotator) {
+	a.Describe(&f.ValidityPeriodHours, "Number of hours, after initial issuing, that the key will remain valid for.")
+	a.Describe(&f.EarlyRenewalHours, "Number of hours, before expiration, that the key will be renewed.")
+	a.Describe(&f.Triggers, "Arbitrary values that replace the key when changed, e.g. a deployment version or an incident ticket.")
+	a.Describe(&f.RotationSchedule, "Cron expression in UTC at which the key is replaced, e.g. `0 2 * JAN,APR,JUL,OCT MON#1` for the first Monday of every quarter at 02:00. "+
+		"Supports minute hour day-of-month month day-of-week, weekday#n for the nth weekday of the month, and @yearly | @quarterly | @monthly | @weekly | @daily | @hourly.")
+}
+
+// State is the rotation output embedded in the state of every key resource.
+type State struct {
+	Created      int64  `pulumi:"created"`
+	ExpiresAt    string `pulumi:"expiresAt,optional"`
+	RenewAt      string `pulumi:"renewAt,optional"`
+	IsExpired    bool   `pulumi:"isExpired,optional"`
+	NextRotation string `pulumi:"nextRotation,optional"`
+}
+
+func (f *State) Annotate(a infer.Annotator) {
+	a.Describe(&f.Created, "Timestamp of creation")
+	a.Describe(&f.ExpiresAt, "RFC3339 time the key expires at, empty when validityPeriodHours is not set.")
+	a.Describe(&f.RenewAt, "RFC3339 time from which the key is replaced on the next update, empty when validityPeriodHours is not set.")
+	a.Describe(&f.IsExpired, "Whether the key had expired when the state was last refreshed.")
+	a.Describe(&f.NextRotation, "RFC3339 time of the first rotationSchedule occurrence after creation, empty when rotationSchedule is not set.")
+}
+
+// Validate checks the rotation inputs at now, returning failures suitable for Check.
+func Validate(args Args, now time.Time) []p.CheckFailure {
+	var failures []p.CheckFailure
+	if args.ValidityPeriodHours < 0 {
+		failures = append(failures, p.CheckFailure{Property: "validityPeriodHours", Reason: "must not be negative"})
+	}
+	if args.EarlyRenewalHours < 0 {
+		failures = append(failures, p.CheckFailure{Property: "earlyRenewalHours", Reason: "must not be negative"})
+	}
+	if args.EarlyRenewalHours > 0 && args.ValidityPeriodHours == 0 {
+		failures = append(failures, p.CheckFailure{Property: "earlyRenewalHours", Reason: "requires validityPeriodHours to be set"})
+	}
+	if args.ValidityPeriodHours > 0 && args.EarlyRenewalHours >= args.ValidityPeriodHours {
+		failures = append(failures, p.CheckFailure{Property: "earlyRenewalHours", Reason: "must be less than validityPeriodHours"})
+	}
+	if args.RotationSchedule != "" {
+		if s, err := ParseSchedule(args.RotationSchedule); err != nil {
+			failures = append(failures, p.CheckFailure{Property: "rotationSchedule", Reason: err.Error()})
+		} else if _, ok := s.Next(now); !ok {
+			failures = append(failures, p.CheckFailure{Property: "rotationSchedule", Reason: "never occurs within the next five years"})
+		}
+	}
+	return failures
+}
+
+// New returns the rotation state of a key created now.
+func New(args Args, now time.Time) State {
+	return Refresh(args, now.Unix(), now)
+}
+
+// Refresh returns the rotation state at now of a key created at created under args.
+func Refresh(args Args, created int64, now time.Time) State {
+	state := State{Created: created}
+	if next, ok := nextRotation(args, created); ok {
+		state.NextRotation = next.Format(time.RFC3339)
+	}
+	if args.ValidityPeriodHours == 0 {
+		return state
+	}
+	expiresAt := time.Unix(created, 0).Add(time.Duration(args.ValidityPeriodHours) * time.Hour)
+	renewAt := expiresAt.Add(-time.Duration(args.EarlyRenewalHours) * time.Hour)
+	state.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	state.RenewAt = renewAt.UTC().Format(time.RFC3339)
+	state.IsExpired = !now.Before(expiresAt)
+	return state
+}
+
+// Due reports whether a key created at created should be replaced at now under args,
+// either because it is about to expire or because its scheduled rotation has passed.
+func Due(args Args, created int64, now time.Time) bool {
+	return expiring(args, created, now) || scheduled(args, created, now)
+}
+
+func expiring(args Args, created int64, now time.Time) bool {
+	if args.ValidityPeriodHours == 0 {
+		return false
+	}
+	return now.Unix() >= created+int64(args.ValidityPeriodHours-args.EarlyRenewalHours)*60*60
+}
+
+func scheduled(args Args, created int64, now time.Time) bool {
+	next, ok := nextRotation(args, created)
+	return ok && !now.Before(next)
+}
+
+// nextRotation is the first occurrence of the rotation schedule after created, invalid
+// schedules are reported by Validate and never rotate.
+func nextRotation(args Args, created int64) (time.Time, bool) {
+	if args.RotationSchedule == "" {
+		return time.Time{}, false
+	}
+	s, err := ParseSchedule(args.RotationSchedule)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return s.Next(time.Unix(created, 0))
+}
+
+// Diff records changes to the rotation inputs in diff, and a replacement once the key is
+// due for renewal, its scheduled rotation has passed or its triggers change.
+func Diff(ctx context.Context, id string, news, olds Args, state State, diff map[string]p.PropertyDiff) {
+	if news.EarlyRenewalHours != olds.EarlyRenewalHours {
+		diff["earlyRenewalHours"] = p.PropertyDiff{Kind: p.Update}
+	}
+	if news.ValidityPeriodHours != olds.ValidityPeriodHours {
+		diff["validityPeriodHours"] = p.PropertyDiff{Kind: p.Update}
+	}
+	if !maps.Equal(news.Triggers, olds.Triggers) {
+		diff["triggers"] = p.PropertyDiff{Kind: p.UpdateReplace}
+	}
+	if news.RotationSchedule != olds.RotationSchedule {
+		diff["rotationSchedule"] = p.PropertyDiff{Kind: p.Update}
+	}
+	now := Now(ctx)
+	if expiring(news, state.Created, now) {
+		diff["expired"] = p.PropertyDiff{Kind: p.UpdateReplace}
+		p.GetLogger(ctx).Warningf("key %s is about to expire, will be replaced if perform this update!", id)
+	}
+	if scheduled(news, state.Created, now) {
+		diff["nextRotation"] = p.PropertyDiff{Kind: p.UpdateReplace}
+		p.GetLogger(ctx).Warningf("key %s passed its scheduled rotation, will be replaced if perform this update!", id)
+	}
+}
+
+// Rotate reports whether a key should be regenerated on an update at now, either because
+// it is due or because its triggers changed.
+func Rotate(news, olds Args, created int64, now time.Time) bool {
+	return Due(news, created, now) || !maps.Equal(news.Triggers, olds.Triggers)
+}
+
+// InPlace turns the replacements caused by rotation in diff into updates, for resources
+// that regenerate the key in Update to keep its previous generations in state.
+func InPlace(diff map[string]p.PropertyDiff) {
+	for _, k := range []string{"triggers", "expired", "nextRotation"} {
+		if d, ok := diff[k]; ok && d.Kind == p.UpdateReplace {
+			diff[k] = p.PropertyDiff{Kind: p.Update}
+		}
+	}
+}
+
+// Retain returns the previous generations to keep, newest first, at most n of them.
+func Retain[T any](previous []T, n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	return previous[:min(len(previous), n)]
+}
@@ -0,0 +1,145 @@
+package rotation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	p "github.com/pulumi/pulumi-go-provider"
+)
+
+// at returns a context whose clock is stopped at now.
+func at(now time.Time) context.Context {
+	return WithClock(context.Background(), func() time.Time { return now })
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		args Args
+		want []string
+	}{
+		{name: "no expiry", args: Args{}},
+		{name: "valid", args: Args{ValidityPeriodHours: 24, EarlyRenewalHours: 1}},
+		{name: "negative validity", args: Args{ValidityPeriodHours: -1}, want: []string{"validityPeriodHours"}},
+		{name: "early renewal without validity", args: Args{EarlyRenewalHours: 1}, want: []string{"earlyRenewalHours"}},
+		{name: "early renewal equals validity", args: Args{ValidityPeriodHours: 24, EarlyRenewalHours: 24}, want: []string{"earlyRenewalHours"}},
+		{name: "early renewal larger than validity", args: Args{ValidityPeriodHours: 24, EarlyRenewalHours: 48}, want: []string{"earlyRenewalHours"}},
+		{name: "schedule", args: Args{RotationSchedule: "@quarterly"}},
+		{name: "invalid schedule", args: Args{RotationSchedule: "every monday"}, want: []string{"rotationSchedule"}},
+		{name: "schedule never occurs", args: Args{RotationSchedule: "0 0 30 2 *"}, want: []string{"rotationSchedule"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := Validate(tt.args, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			if len(failures) != len(tt.want) {
+				t.Fatalf("got failures %v, want failures on %v", failures, tt.want)
+			}
+			for i, f := range failures {
+				if f.Property != tt.want[i] {
+					t.Fatalf("got failure on %s, want %s", f.Property, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	args := Args{ValidityPeriodHours: 24, EarlyRenewalHours: 2}
+
+	state := Refresh(args, created.Unix(), created.Add(23*time.Hour))
+	if state.ExpiresAt != "2024-01-02T00:00:00Z" || state.RenewAt != "2024-01-01T22:00:00Z" || state.IsExpired {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	if state := Refresh(args, created.Unix(), created.Add(24*time.Hour)); !state.IsExpired {
+		t.Fatalf("expected key to be expired, got %+v", state)
+	}
+
+	if state := Refresh(Args{}, created.Unix(), created); state.ExpiresAt != "" || state.RenewAt != "" || state.IsExpired {
+		t.Fatalf("expected no expiry without validityPeriodHours, got %+v", state)
+	}
+
+	if state := Refresh(Args{RotationSchedule: "0 2 * JAN,APR,JUL,OCT MON#1"}, created.Unix(), created); state.NextRotation != "2024-01-01T02:00:00Z" {
+		t.Fatalf("unexpected next rotation %+v", state)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	args := Args{ValidityPeriodHours: 24, EarlyRenewalHours: 2}
+	state := State{Created: created.Unix()}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		news Args
+		want map[string]p.DiffKind
+	}{
+		{name: "fresh", now: created.Add(time.Hour), news: args, want: map[string]p.DiffKind{}},
+		{name: "before renewal", now: created.Add(22*time.Hour - time.Second), news: args, want: map[string]p.DiffKind{}},
+		{name: "renewal due", now: created.Add(22 * time.Hour), news: args, want: map[string]p.DiffKind{"expired": p.UpdateReplace}},
+		{name: "never expires", now: created.Add(1000 * time.Hour), news: Args{}, want: map[string]p.DiffKind{
+			"validityPeriodHours": p.Update,
+			"earlyRenewalHours":   p.Update,
+		}},
+		{name: "new trigger", now: created.Add(time.Hour), news: Args{ValidityPeriodHours: 24, EarlyRenewalHours: 2, Triggers: map[string]string{"ticket": "INC-1"}}, want: map[string]p.DiffKind{
+			"triggers": p.UpdateReplace,
+		}},
+		{name: "add schedule", now: created.Add(time.Hour), news: Args{ValidityPeriodHours: 24, EarlyRenewalHours: 2, RotationSchedule: "@daily"}, want: map[string]p.DiffKind{
+			"rotationSchedule": p.Update,
+		}},
+		{name: "scheduled rotation", now: created.Add(24 * time.Hour), news: Args{ValidityPeriodHours: 48, EarlyRenewalHours: 2, RotationSchedule: "@daily"}, want: map[string]p.DiffKind{
+			"validityPeriodHours": p.Update,
+			"rotationSchedule":    p.Update,
+			"nextRotation":        p.UpdateReplace,
+		}},
+		{name: "longer validity", now: created.Add(23 * time.Hour), news: Args{ValidityPeriodHours: 48, EarlyRenewalHours: 2}, want: map[string]p.DiffKind{
+			"validityPeriodHours": p.Update,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := map[string]p.PropertyDiff{}
+			Diff(at(tt.now), "key", tt.news, args, state, diff)
+			if len(diff) != len(tt.want) {
+				t.Fatalf("got diff %v, want %v", diff, tt.want)
+			}
+			for k, kind := range tt.want {
+				if diff[k].Kind != kind {
+					t.Fatalf("got %s for %s, want %s", diff[k].Kind, k, kind)
+				}
+			}
+		})
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	diff := map[string]p.PropertyDiff{
+		"keyId":        {Kind: p.UpdateReplace},
+		"triggers":     {Kind: p.UpdateReplace},
+		"expired":      {Kind: p.UpdateReplace},
+		"nextRotation": {Kind: p.UpdateReplace},
+	}
+	InPlace(diff)
+	want := map[string]p.DiffKind{"keyId": p.UpdateReplace, "triggers": p.Update, "expired": p.Update, "nextRotation": p.Update}
+	for k, kind := range want {
+		if diff[k].Kind != kind {
+			t.Fatalf("got %s for %s, want %s", diff[k].Kind, k, kind)
+		}
+	}
+}
+
+func TestRetain(t *testing.T) {
+	versions := []int{3, 2, 1}
+	if got := Retain(versions, 2); len(got) != 2 || got[0] != 3 {
+		t.Fatalf("got %v, want the 2 newest", got)
+	}
+	if got := Retain(versions, 5); len(got) != 3 {
+		t.Fatalf("got %v, want all", got)
+	}
+	if got := Retain(versions, 0); got != nil {
+		t.Fatalf("got %v, want none", got)
+	}
+}
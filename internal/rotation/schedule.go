@@ -0,0 +1,183 @@
+package rotation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression evaluated in UTC.
+//
+// It accepts the standard five fields, minute hour day-of-month month day-of-week, with
+// lists, ranges, steps and month/day names. The day-of-week field also accepts the nth
+// weekday of the month as weekday#n, so "0 2 * JAN,APR,JUL,OCT MON#1" is the first Monday
+// of every quarter at 02:00 UTC. The @yearly, @quarterly, @monthly, @weekly, @daily and
+// @hourly shorthands are supported as well.
+type Schedule struct {
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	nth    [7][6]bool
+
+	domStar, dowStar bool
+}
+
+var shorthands = map[string]string{
+	"@yearly":    "0 0 1 1 *",
+	"@annually":  "0 0 1 1 *",
+	"@quarterly": "0 0 1 1,4,7,10 *",
+	"@monthly":   "0 0 1 * *",
+	"@weekly":    "0 0 * * 0",
+	"@daily":     "0 0 * * *",
+	"@midnight":  "0 0 * * *",
+	"@hourly":    "0 * * * *",
+}
+
+var monthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+var dayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// ParseSchedule parses a cron expression.
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if s, ok := shorthands[strings.ToLower(expr)]; ok {
+		expr = s
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in %q, got %d", expr, len(fields))
+	}
+	s := &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	if err := parseField(fields[0], 0, 59, nil, s.minute[:]); err != nil {
+		return nil, fmt.Errorf("minute: %s", err)
+	}
+	if err := parseField(fields[1], 0, 23, nil, s.hour[:]); err != nil {
+		return nil, fmt.Errorf("hour: %s", err)
+	}
+	if err := parseField(fields[2], 1, 31, nil, s.dom[:]); err != nil {
+		return nil, fmt.Errorf("day of month: %s", err)
+	}
+	if err := parseField(fields[3], 1, 12, monthNames, s.month[:]); err != nil {
+		return nil, fmt.Errorf("month: %s", err)
+	}
+	var plain []string
+	for _, item := range strings.Split(fields[4], ",") {
+		day, n, ok := strings.Cut(item, "#")
+		if !ok {
+			plain = append(plain, item)
+			continue
+		}
+		weekday, err := parseValue(day, 0, 7, dayNames)
+		if err != nil {
+			return nil, fmt.Errorf("day of week: %s", err)
+		}
+		nth, err := strconv.Atoi(n)
+		if err != nil || nth < 1 || nth > 5 {
+			return nil, fmt.Errorf("day of week: occurrence in %q must be between 1 and 5", item)
+		}
+		s.nth[weekday%7][nth] = true
+	}
+	if len(plain) > 0 {
+		var dow [8]bool
+		if err := parseField(strings.Join(plain, ","), 0, 7, dayNames, dow[:]); err != nil {
+			return nil, fmt.Errorf("day of week: %s", err)
+		}
+		copy(s.dow[:], dow[:7])
+		s.dow[0] = s.dow[0] || dow[7]
+	}
+	return s, nil
+}
+
+func parseField(field string, min, max int, names []string, set []bool) error {
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step in %q", item)
+			}
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(from, min, max, names); err != nil {
+				return err
+			}
+			if hi, err = parseValue(to, min, max, names); err != nil {
+				return err
+			}
+			if lo > hi {
+				return fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			var err error
+			if lo, err = parseValue(rng, min, max, names); err != nil {
+				return err
+			}
+			if !hasStep {
+				hi = lo
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+func parseValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			// month names start at 1, day names at 0
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%q must be between %d and %d", s, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first time of the schedule strictly after t, or false when there is
+// none within the next five years.
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !s.hour[t.Hour()]:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[t.Weekday()] || s.nth[t.Weekday()][(t.Day()-1)/7+1]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	// like cron, a day matches either restricted field
+	return dom || dow
+}
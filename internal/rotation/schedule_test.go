@@ -0,0 +1,58 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "*/15 * * * *", want: "2024-01-10T12:45:00Z"},
+		{expr: "0 2 * * *", want: "2024-01-11T02:00:00Z"},
+		{expr: "@monthly", want: "2024-02-01T00:00:00Z"},
+		{expr: "@quarterly", want: "2024-04-01T00:00:00Z"},
+		{expr: "0 2 * JAN,APR,JUL,OCT MON#1", want: "2024-04-01T02:00:00Z"},
+		{expr: "0 2 * 1-12/3 1#1", want: "2024-04-01T02:00:00Z"},
+		{expr: "0 0 * * FRI#5", want: "2024-03-29T00:00:00Z"},
+		{expr: "0 0 29 2 *", want: "2024-02-29T00:00:00Z"},
+		{expr: "0 0 13 * 5", want: "2024-01-12T00:00:00Z"},
+		{expr: "0 0 * * 7", want: "2024-01-14T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, ok := s.Next(from)
+			if !ok {
+				t.Fatal("expected a next occurrence")
+			}
+			if got := next.Format(time.RFC3339); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "0 0 32 * *", "0 0 * FOO *", "0 0 * * MON#6", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Fatalf("expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestScheduleNeverOccurs(t *testing.T) {
+	s, err := ParseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Fatal("expected February 31st to never occur")
+	}
+}
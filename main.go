@@ -7,36 +7,57 @@ import (
 
 	"github.com/jcouyang/pulumi-keygen/age"
 	"github.com/jcouyang/pulumi-keygen/awskms"
+	"github.com/jcouyang/pulumi-keygen/derive"
+	p "github.com/pulumi/pulumi-go-provider"
 	"github.com/pulumi/pulumi-go-provider/infer"
 )
 
 func main() {
-	provider, err := infer.NewProviderBuilder().
+	provider, err := newProvider(&awskms.Config{})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s", err.Error())
+		os.Exit(1)
+	}
+
+	err = provider.Run(context.Background(), "keygen", "0.1.0")
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+// newProvider builds the keygen provider, config is where the awskms configuration is
+// decoded into so tests can start from awskms.WithKMS.
+func newProvider(config *awskms.Config) (p.Provider, error) {
+	return infer.NewProviderBuilder().
 		WithResources(
 			infer.Resource(age.Identity{}),
 			infer.Resource(awskms.Random{}),
 			infer.Resource(awskms.DataKeyPair{}),
 			infer.Resource(awskms.DataKey{}),
+			infer.Resource(awskms.ReEncryptedBlob{}),
+			infer.Resource(awskms.SelfSignedCert{}),
+			infer.Resource(awskms.CertRequest{}),
+			infer.Resource(awskms.LocallySignedCert{}),
+			infer.Resource(derive.Key{}),
 		).
 		WithFunctions(
 			infer.Function(age.Encrypt{}),
 			infer.Function(age.Decrypt{}),
 			infer.Function(awskms.Encrypt{}),
 			infer.Function(awskms.Decrypt{}),
+			infer.Function(awskms.Sign{}),
+			infer.Function(awskms.Verify{}),
+			infer.Function(awskms.GenerateMac{}),
+			infer.Function(awskms.VerifyMac{}),
+			infer.Function(awskms.ReEncrypt{}),
+			infer.Function(awskms.GetPublicKey{}),
+			infer.Function(derive.DeriveKey{}),
 		).
+		WithConfig(infer.Config(config)).
 		WithNamespace("pulumi-resource-keygen").
 		WithDisplayName("keygen").
 		Build()
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s", err.Error())
-		os.Exit(1)
-	}
-
-	err = provider.Run(context.Background(), "keygen", "0.1.0")
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s", err.Error())
-		os.Exit(1)
-	}
 }
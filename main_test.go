@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/blang/semver"
+	"github.com/jcouyang/pulumi-keygen/awskms"
+	"github.com/jcouyang/pulumi-keygen/internal/kmstest"
+	p "github.com/pulumi/pulumi-go-provider"
+	"github.com/pulumi/pulumi-go-provider/integration"
+	presource "github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/tokens"
+	"github.com/pulumi/pulumi/sdk/v3/go/property"
+)
+
+// newServer serves the provider from main against an in-memory KMS.
+func newServer(t *testing.T) integration.Server {
+	t.Helper()
+	provider, err := newProvider(awskms.WithKMS(kmstest.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := integration.NewServer(context.Background(), "keygen", semver.MustParse("0.1.0"), integration.WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Configure(p.ConfigureRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// secret fails unless every key of outputs is set and marked secret.
+func secret(t *testing.T, outputs property.Map, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		v, ok := outputs.GetOk(key)
+		if !ok || v.IsNull() {
+			t.Errorf("expected %s to be set", key)
+		} else if !v.Secret() {
+			t.Errorf("expected %s to be secret", key)
+		}
+	}
+}
+
+// public fails unless every key of outputs is set and not marked secret.
+func public(t *testing.T, outputs property.Map, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		v, ok := outputs.GetOk(key)
+		if !ok || v.IsNull() {
+			t.Errorf("expected %s to be set", key)
+		} else if v.Secret() {
+			t.Errorf("expected %s not to be secret", key)
+		}
+	}
+}
+
+func inputs(values map[string]property.Value) property.Map {
+	return property.NewMap(values)
+}
+
+func invoke(t *testing.T, server integration.Server, token string, args map[string]property.Value) property.Map {
+	t.Helper()
+	resp, err := server.Invoke(p.InvokeRequest{Token: tokens.Type(token), Args: property.NewMap(args)})
+	if err != nil {
+		t.Fatalf("%s: %s", token, err)
+	}
+	if len(resp.Failures) > 0 {
+		t.Fatalf("%s: unexpected failures %v", token, resp.Failures)
+	}
+	return resp.Return
+}
+
+func TestIdentity(t *testing.T) {
+	random := property.New(base64.StdEncoding.EncodeToString(make([]byte, 32))).WithSecret(true)
+	integration.LifeCycleTest{
+		Resource: "keygen:age:Identity",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{"random": random}),
+			Hook: func(_, outputs property.Map) {
+				secret(t, outputs, "key", "random")
+				public(t, outputs, "recipient")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{"keyType": property.New("MLKEM768X25519")}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "key")
+					if !strings.HasPrefix(outputs.Get("recipient").AsString(), "age1pq1") {
+						t.Errorf("expected a post-quantum recipient, got %s", outputs.Get("recipient").AsString())
+					}
+				},
+			},
+			{
+				Inputs: inputs(map[string]property.Value{
+					"keyType":                property.New("MLKEM768X25519"),
+					"retainPreviousVersions": property.New(1.0),
+					"triggers":               property.New(property.NewMap(map[string]property.Value{"version": property.New("2")})),
+				}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "key", "previousVersions")
+				},
+			},
+			{
+				Inputs:        inputs(map[string]property.Value{"keyType": property.New("RSA")}),
+				CheckFailures: []p.CheckFailure{{Property: "keyType", Reason: `unknown value "RSA", must be one of X25519 | MLKEM768X25519`}},
+			},
+		},
+	}.Run(t, newServer(t))
+}
+
+func TestIdentityImport(t *testing.T) {
+	server := newServer(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	urn := presource.NewURN("test", "keygen", "", "keygen:age:Identity", "imported")
+	read, err := server.Read(p.ReadRequest{ID: identity.String(), Urn: urn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ID != identity.Recipient().String() {
+		t.Fatalf("expected the identity to be imported by its recipient, got %s", read.ID)
+	}
+	if read.Properties.Get("key").AsString() != identity.String() {
+		t.Fatal("expected the imported identity in state")
+	}
+	public(t, read.Properties, "recipient")
+	check, err := server.Check(p.CheckRequest{Urn: urn, State: read.Properties, Inputs: read.Inputs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Failures) > 0 {
+		t.Fatalf("unexpected failures %v", check.Failures)
+	}
+	diff, err := server.Diff(p.DiffRequest{ID: read.ID, Urn: urn, State: read.Properties, Inputs: check.Inputs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.HasChanges {
+		t.Fatalf("expected no changes after import, got %v", diff.DetailedDiff)
+	}
+
+	if _, err := server.Read(p.ReadRequest{ID: identity.Recipient().String(), Urn: urn}); err == nil {
+		t.Fatal("expected an import by recipient to fail")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	integration.LifeCycleTest{
+		Resource: "keygen:awskms:Random",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{"numberOfBytes": property.New(32.0)}),
+			Hook: func(_, outputs property.Map) {
+				secret(t, outputs, "plaintext")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{"numberOfBytes": property.New(32.0), "validityPeriodHours": property.New(24.0)}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "plaintext")
+					public(t, outputs, "expiresAt")
+				},
+			},
+			{
+				Inputs: inputs(map[string]property.Value{"numberOfBytes": property.New(16.0)}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "plaintext")
+				},
+			},
+			{
+				Inputs:        inputs(map[string]property.Value{"numberOfBytes": property.New(0.0)}),
+				CheckFailures: []p.CheckFailure{{Property: "numberOfBytes", Reason: "must be between 1 and 1024, got 0"}},
+			},
+		},
+	}.Run(t, newServer(t))
+}
+
+func TestDataKey(t *testing.T) {
+	keyId := property.New("alias/app")
+	integration.LifeCycleTest{
+		Resource: "keygen:awskms:DataKey",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{"keyId": keyId, "keySpec": property.New("AES_256")}),
+			Hook: func(_, outputs property.Map) {
+				secret(t, outputs, "plaintext")
+				public(t, outputs, "ciphertextBlob")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{
+					"keyId":                  keyId,
+					"keySpec":                property.New("AES_256"),
+					"retainPreviousVersions": property.New(1.0),
+					"triggers":               property.New(property.NewMap(map[string]property.Value{"version": property.New("2")})),
+				}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "plaintext", "previousVersions")
+				},
+			},
+			{
+				Inputs: inputs(map[string]property.Value{"keyId": keyId, "numberOfBytes": property.New(64.0)}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "plaintext")
+				},
+			},
+		},
+	}.Run(t, newServer(t))
+}
+
+func TestDataKeyPair(t *testing.T) {
+	keyId := property.New("alias/app")
+	integration.LifeCycleTest{
+		Resource: "keygen:awskms:DataKeyPair",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{"keyId": keyId, "keyPairSpec": property.New("ECC_NIST_P256")}),
+			Hook: func(_, outputs property.Map) {
+				secret(t, outputs, "privateKey", "privateKeyPem")
+				public(t, outputs, "publicKey", "publicKeyPem", "privateKeyCiphertextBlob")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{"keyId": keyId, "keyPairSpec": property.New("RSA_2048")}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "privateKey")
+				},
+			},
+		},
+	}.Run(t, newServer(t))
+}
+
+func TestReEncryptedBlob(t *testing.T) {
+	server := newServer(t)
+	encrypted := invoke(t, server, "keygen:awskms:encrypt", map[string]property.Value{
+		"keyId":     property.New("alias/old"),
+		"plaintext": property.New(base64.StdEncoding.EncodeToString([]byte("hello"))),
+	})
+	integration.LifeCycleTest{
+		Resource: "keygen:awskms:ReEncryptedBlob",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{
+				"sourceCiphertextBlob": encrypted.Get("result"),
+				"destinationKeyId":     property.New("alias/new"),
+			}),
+			Hook: func(_, outputs property.Map) {
+				public(t, outputs, "ciphertextBlob")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{
+					"sourceCiphertextBlob": encrypted.Get("result"),
+					"destinationKeyId":     property.New("alias/newer"),
+				}),
+				Hook: func(_, outputs property.Map) {
+					public(t, outputs, "ciphertextBlob")
+				},
+			},
+		},
+	}.Run(t, server)
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	server := newServer(t)
+	// the local key store creates the key pair of a key on its first signature
+	invoke(t, server, "keygen:awskms:sign", map[string]property.Value{
+		"keyId":            property.New("alias/ca"),
+		"message":          property.New("init"),
+		"signingAlgorithm": property.New("ECDSA_SHA_256"),
+	})
+	create := map[string]property.Value{
+		"keyId": property.New("alias/ca"),
+		"subject": property.New(property.NewMap(map[string]property.Value{
+			"commonName": property.New("ACME Root CA"),
+		})),
+		"isCaCertificate":     property.New(true),
+		"allowedUses":         property.New([]property.Value{property.New("cert_signing")}),
+		"validityPeriodHours": property.New(24.0),
+	}
+	var certPem string
+	integration.LifeCycleTest{
+		Resource: "keygen:awskms:SelfSignedCert",
+		Create: integration.Operation{
+			Inputs: inputs(create),
+			Hook: func(_, outputs property.Map) {
+				public(t, outputs, "certPem")
+				certPem = outputs.Get("certPem").AsString()
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{
+					"keyId":               create["keyId"],
+					"subject":             create["subject"],
+					"isCaCertificate":     create["isCaCertificate"],
+					"allowedUses":         create["allowedUses"],
+					"validityPeriodHours": create["validityPeriodHours"],
+					"earlyRenewalHours":   property.New(12.0),
+				}),
+				Hook: func(_, outputs property.Map) {
+					if outputs.Get("certPem").AsString() != certPem {
+						t.Error("expected earlyRenewalHours to keep the certificate")
+					}
+				},
+			},
+		},
+	}.Run(t, server)
+}
+
+func TestDeriveKey(t *testing.T) {
+	master := property.New("master secret").WithSecret(true)
+	integration.LifeCycleTest{
+		Resource: "keygen:derive:Key",
+		Create: integration.Operation{
+			Inputs: inputs(map[string]property.Value{"master": master, "info": property.New("app")}),
+			Hook: func(_, outputs property.Map) {
+				secret(t, outputs, "key", "master")
+			},
+		},
+		Updates: []integration.Operation{
+			{
+				Inputs: inputs(map[string]property.Value{"master": master, "info": property.New("app"), "format": property.New("age")}),
+				Hook: func(_, outputs property.Map) {
+					secret(t, outputs, "key", "master")
+					public(t, outputs, "recipient")
+				},
+			},
+		},
+	}.Run(t, newServer(t))
+}
+
+func TestFunctions(t *testing.T) {
+	server := newServer(t)
+	master := property.New("master secret").WithSecret(true)
+
+	derived := invoke(t, server, "keygen:derive:deriveKey", map[string]property.Value{
+		"master": master,
+		"info":   property.New("age"),
+		"format": property.New("age"),
+	})
+	secret(t, derived, "key")
+	public(t, derived, "recipient")
+
+	encrypted := invoke(t, server, "keygen:age:encrypt", map[string]property.Value{
+		"recipients": property.New([]property.Value{derived.Get("recipient")}),
+		"plaintext":  property.New("hello").WithSecret(true),
+	})
+	public(t, encrypted, "result")
+	decrypted := invoke(t, server, "keygen:age:decrypt", map[string]property.Value{
+		"identity":   derived.Get("key"),
+		"ciphertext": encrypted.Get("result"),
+	})
+	secret(t, decrypted, "result")
+	if got := decrypted.Get("result").AsString(); got != "hello" {
+		t.Errorf("expected age decrypt to return hello, got %s", got)
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("hello"))
+	encrypted = invoke(t, server, "keygen:awskms:encrypt", map[string]property.Value{
+		"keyId":     property.New("alias/app"),
+		"plaintext": property.New(plaintext).WithSecret(true),
+	})
+	public(t, encrypted, "result")
+	decrypted = invoke(t, server, "keygen:awskms:decrypt", map[string]property.Value{
+		"ciphertext": encrypted.Get("result"),
+	})
+	secret(t, decrypted, "result")
+	if got := decrypted.Get("result").AsString(); got != plaintext {
+		t.Errorf("expected awskms decrypt to return %s, got %s", plaintext, got)
+	}
+
+	signed := invoke(t, server, "keygen:awskms:sign", map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("hello"),
+		"signingAlgorithm": property.New("ECDSA_SHA_256"),
+	})
+	public(t, signed, "signature")
+	verified := invoke(t, server, "keygen:awskms:verify", map[string]property.Value{
+		"keyId":            property.New("alias/signer"),
+		"message":          property.New("hello"),
+		"signature":        signed.Get("signature"),
+		"signingAlgorithm": property.New("ECDSA_SHA_256"),
+	})
+	if !verified.Get("valid").AsBool() {
+		t.Error("expected awskms verify to accept the signature of sign")
+	}
+	publicKey := invoke(t, server, "keygen:awskms:getPublicKey", map[string]property.Value{
+		"keyId": property.New("alias/signer"),
+	})
+	public(t, publicKey, "publicKey", "publicKeyPem", "keySpec")
+
+	mac := invoke(t, server, "keygen:awskms:generateMac", map[string]property.Value{
+		"keyId":        property.New("alias/hmac"),
+		"message":      property.New("hello"),
+		"macAlgorithm": property.New("HMAC_SHA_256"),
+	})
+	secret(t, mac, "mac")
+	verified = invoke(t, server, "keygen:awskms:verifyMac", map[string]property.Value{
+		"keyId":        property.New("alias/hmac"),
+		"message":      property.New("hello"),
+		"mac":          mac.Get("mac"),
+		"macAlgorithm": property.New("HMAC_SHA_256"),
+	})
+	if !verified.Get("valid").AsBool() {
+		t.Error("expected awskms verifyMac to accept the mac of generateMac")
+	}
+
+	reEncrypted := invoke(t, server, "keygen:awskms:reEncrypt", map[string]property.Value{
+		"ciphertext":       encrypted.Get("result"),
+		"destinationKeyId": property.New("alias/new"),
+	})
+	public(t, reEncrypted, "result", "sourceKeyId")
+}
+
+func TestSchema(t *testing.T) {
+	resp, err := newServer(t).GetSchema(p.GetSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type property struct {
+		Secret bool `json:"secret"`
+	}
+	var schema struct {
+		Name      string `json:"name"`
+		Resources map[string]struct {
+			Properties      map[string]property `json:"properties"`
+			InputProperties map[string]property `json:"inputProperties"`
+		} `json:"resources"`
+		Functions map[string]struct {
+			Outputs struct {
+				Properties map[string]property `json:"properties"`
+			} `json:"outputs"`
+		} `json:"functions"`
+		Config struct {
+			Variables map[string]property `json:"variables"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal([]byte(resp.Schema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Name != "keygen" {
+		t.Errorf("expected package keygen, got %s", schema.Name)
+	}
+
+	for token, secrets := range map[string][]string{
+		"keygen:age:Identity":             {"key", "random", "privateKey", "previousVersions"},
+		"keygen:awskms:Random":            {"plaintext"},
+		"keygen:awskms:DataKey":           {"plaintext", "previousVersions"},
+		"keygen:awskms:DataKeyPair":       {"privateKey", "privateKeyPem"},
+		"keygen:awskms:ReEncryptedBlob":   nil,
+		"keygen:awskms:SelfSignedCert":    nil,
+		"keygen:awskms:CertRequest":       nil,
+		"keygen:awskms:LocallySignedCert": nil,
+		"keygen:derive:Key":               {"key", "master"},
+	} {
+		resource, ok := schema.Resources[token]
+		if !ok {
+			t.Errorf("expected resource %s", token)
+			continue
+		}
+		for _, name := range secrets {
+			if p, ok := resource.Properties[name]; !ok || !p.Secret {
+				t.Errorf("expected %s of %s to be a secret output", name, token)
+			}
+		}
+	}
+	if n := len(schema.Resources); n != 9 {
+		t.Errorf("expected 9 resources, got %d", n)
+	}
+
+	for token, secrets := range map[string][]string{
+		"keygen:age:encrypt":         nil,
+		"keygen:age:decrypt":         {"result"},
+		"keygen:awskms:encrypt":      nil,
+		"keygen:awskms:decrypt":      {"result"},
+		"keygen:awskms:sign":         nil,
+		"keygen:awskms:verify":       nil,
+		"keygen:awskms:generateMac":  {"mac"},
+		"keygen:awskms:verifyMac":    nil,
+		"keygen:awskms:reEncrypt":    nil,
+		"keygen:awskms:getPublicKey": nil,
+		"keygen:derive:deriveKey":    {"key"},
+	} {
+		function, ok := schema.Functions[token]
+		if !ok {
+			t.Errorf("expected function %s", token)
+			continue
+		}
+		for _, name := range secrets {
+			if p, ok := function.Outputs.Properties[name]; !ok || !p.Secret {
+				t.Errorf("expected %s of %s to be a secret output", name, token)
+			}
+		}
+	}
+	if n := len(schema.Functions); n != 11 {
+		t.Errorf("expected 11 functions, got %d", n)
+	}
+
+	for _, name := range []string{"region", "profile", "roleArn", "endpoint", "localKeyStore"} {
+		if _, ok := schema.Config.Variables[name]; !ok {
+			t.Errorf("expected config variable %s", name)
+		}
+	}
+}